@@ -0,0 +1,46 @@
+package parallel
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrOptInvalidValueDeadLetter indicates the dead letter callback or channel is nil
+var ErrOptInvalidValueDeadLetter = errors.New("invalid option value: dead letter")
+
+// DeadLetter is a job that a mapper failed on
+type DeadLetter struct {
+	Job interface{}
+	// Err is the error returned by the mapper or an ErrTrappedPanic
+	Err error
+	// Attempts is the number of times the job was mapped
+	Attempts int
+	// First is when the first attempt started and Last when the last attempt failed
+	First, Last time.Time
+}
+
+// OptDeadLetter passes the jobs that a mapper fails on to fn instead of failing the operation,
+// the remaining jobs are mapped and reduced as normal. Panics in the mapper are trapped for
+// each job and passed to fn as an ErrTrappedPanic, the `init` value of the go routine is kept.
+// fn is called on the mapper go routine so it should not block
+func OptDeadLetter(fn func(DeadLetter)) Option {
+	return func(o *options) error {
+		if fn == nil {
+			return ErrOptInvalidValueDeadLetter
+		}
+		o.deadLetter, o.deadLetters = fn, nil
+		return nil
+	}
+}
+
+// OptDeadLetterChan is the equivalent of OptDeadLetter that sends the failed jobs on c, the
+// mapper go routine blocks until the job is received or the operation is cancelled
+func OptDeadLetterChan(c chan<- DeadLetter) Option {
+	return func(o *options) error {
+		if c == nil {
+			return ErrOptInvalidValueDeadLetter
+		}
+		o.deadLetter, o.deadLetters = nil, c
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// failOdd fails on odd jobs and panics on multiples of 10
+func failOdd(_ interface{}, j int) (int, error) {
+	if j%10 == 0 {
+		panic("junk")
+	}
+
+	if j%2 == 1 {
+		return 0, errOdd
+	}
+
+	return j, nil
+}
+
+func TestDeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	var letters []DeadLetter
+
+	op, err := StartErrOf(0, failOdd, func(p int, c int) int {
+		return p + c
+	}, OptDeadLetter(func(d DeadLetter) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		letters = append(letters, d)
+	}), OptBatch(3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 20; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	total, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 + 4 + 6 + 8 + 12 + 14 + 16 + 18
+	if total != 80 {
+		t.Error("total incorrect", total)
+	}
+
+	if len(letters) != 12 {
+		t.Fatal("unexpected letters", letters)
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].Job.(int) < letters[j].Job.(int)
+	})
+
+	for _, d := range letters {
+		var pnk ErrTrappedPanic
+		if j := d.Job.(int); j%10 == 0 {
+			if !errors.As(d.Err, &pnk) || pnk.Job != j {
+				t.Error("unexpected error", j, d.Err)
+			}
+		} else if d.Err != errOdd {
+			t.Error("unexpected error", j, d.Err)
+		}
+
+		if d.Attempts != 1 || d.First.IsZero() || d.Last.Before(d.First) {
+			t.Error("unexpected letter", d)
+		}
+	}
+}
+
+func TestDeadLetterChan(t *testing.T) {
+	letters := make(chan DeadLetter)
+
+	op, err := StartErrOf(0, failOdd, func(p int, c int) int {
+		return p + c
+	}, OptDeadLetterChan(letters), OptFailure(CollectAll))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for i := 1; i <= 9; i++ {
+			if err := op.Submit(context.Background(), i); err != nil {
+				t.Error(err)
+			}
+		}
+		op.CloseInput()
+	}()
+
+	var jobs []int
+	for len(jobs) < 5 {
+		jobs = append(jobs, (<-letters).Job.(int))
+	}
+	sort.Ints(jobs)
+
+	if jobs[0] != 1 || jobs[4] != 9 {
+		t.Error("unexpected jobs", jobs)
+	}
+
+	if total, err := op.Wait(context.Background()); err != nil || total != 20 {
+		t.Error("unexpected result", total, err)
+	}
+}
+
+func TestDeadLetterInvalid(t *testing.T) {
+	for _, opt := range []Option{OptDeadLetter(nil), OptDeadLetterChan(nil)} {
+		if _, err := StartErrOf(0, failOdd, nil, opt); err != ErrOptInvalidValueDeadLetter {
+			t.Error("unexpected error", err)
+		}
+	}
+}
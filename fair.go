@@ -0,0 +1,162 @@
+package parallel
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrOptInvalidValueTenant indicates the weight or the cap of an operation on a pool is invalid
+var ErrOptInvalidValueTenant = errors.New("invalid option value: tenant")
+
+// OptFairShare makes the pool share its go routines between the operations that run on it in
+// proportion to their weight, see OptTenant. Without it every go routine joins the oldest
+// operation with jobs left, so a long running operation can hold the whole pool while the
+// others wait. Go routines move to another operation between jobs
+func OptFairShare() PoolOption {
+	return func(m *mapper) {
+		m.fair = true
+	}
+}
+
+// OptTenant names an operation that runs on a pool, see Pool.Usage, and sets its weight for a
+// pool with OptFairShare, defaults to 1. An operation is never mapped by more than max go
+// routines of the pool unless max is 0
+func OptTenant(name string, weight int, max int) Option {
+	return func(o *options) error {
+		if weight < 1 || max < 0 {
+			return ErrOptInvalidValueTenant
+		}
+		o.tenant, o.weight, o.max = name, weight, max
+		return nil
+	}
+}
+
+// OpUsage is a snapshot of the go routines of a pool used by an operation
+type OpUsage struct {
+	// Name is set by OptTenant
+	Name string
+	// Workers is the number of go routines that are mapping the jobs of the operation
+	Workers int
+	Weight  int
+	Max     int
+}
+
+// Usage returns the operations running on the pool, in the order they were started
+func (p *Pool) Usage() []OpUsage {
+	p.m.mu.Lock()
+	defer p.m.mu.Unlock()
+
+	usage := make([]OpUsage, 0, len(p.m.ops))
+	for _, op := range p.m.ops {
+		usage = append(usage, OpUsage{Name: op.name, Workers: op.attached, Weight: op.weight, Max: op.max})
+	}
+
+	return usage
+}
+
+// pick returns the operation a go routine should join, the oldest one below its cap or
+// with OptFairShare the one furthest below its share. mu must be held
+func (m *mapper) pick() *mapperOp {
+	var best *mapperOp
+	for _, op := range m.ops {
+		if op.max > 0 && op.attached >= op.max {
+			continue
+		}
+
+		if !m.fair {
+			return op
+		}
+
+		if best == nil || op.attached*best.weight < best.attached*op.weight {
+			best = op
+		}
+	}
+
+	return best
+}
+
+// rebalance works out the share of the go routines of every operation with OptFairShare and
+// wakes the go routines of the operations above their share, so they yield to the others.
+// The shares are in proportion to the weights, except for the operations capped below their
+// share whose go routines are spread over the rest. mu must be held
+func (m *mapper) rebalance() {
+	if !m.fair || len(m.ops) == 0 {
+		return
+	}
+
+	shares := make(map[*mapperOp]int, len(m.ops))
+	left, weights := len(m.workers), 0
+	for _, op := range m.ops {
+		weights += op.weight
+	}
+
+	// give the capped operations their cap until the remaining ones are all below theirs
+	for capped := true; capped && weights > 0; {
+		capped = false
+		for _, op := range m.ops {
+			if _, ok := shares[op]; ok || op.max == 0 || op.max*weights > left*op.weight {
+				continue
+			}
+
+			shares[op] = op.max
+			left -= op.max
+			weights -= op.weight
+			capped = true
+		}
+	}
+
+	// round the rest down and hand out the remainder in the order the operations started
+	rest := left
+	for _, op := range m.ops {
+		if _, ok := shares[op]; !ok && weights > 0 {
+			shares[op] = left * op.weight / weights
+			rest -= shares[op]
+		}
+	}
+	for _, op := range m.ops {
+		if rest == 0 {
+			break
+		}
+		if op.max == 0 || shares[op] < op.max {
+			shares[op]++
+			rest--
+		}
+	}
+
+	for _, op := range m.ops {
+		excess := op.attached - shares[op]
+		if excess < 0 {
+			excess = 0
+		}
+		atomic.StoreInt32(&op.excess, int32(excess))
+
+		if excess == 0 {
+			continue
+		}
+
+		for _, w := range m.workers {
+			if w.op == op {
+				select {
+				case w.wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// yield reports if the go routine should leave its operation for another one, the
+// go routine owns w.op while it is attached
+func (w *worker) yield() bool {
+	op := w.op
+	for {
+		excess := atomic.LoadInt32(&op.excess)
+		if excess <= 0 {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt32(&op.excess, excess, excess-1) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package parallel
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startBusy starts an operation on p with n jobs that take a millisecond each, active
+// tracks the number of jobs being mapped
+func startBusy(t *testing.T, p *Pool, n int, active *int32, opts ...Option) *OpOf[int, int] {
+	t.Helper()
+
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		atomic.AddInt32(active, 1)
+		defer atomic.AddInt32(active, -1)
+
+		time.Sleep(time.Millisecond)
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, append(opts, p.Option(), OptQueue(n))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= n; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	return op
+}
+
+// workers returns the number of go routines used by each named operation
+func workers(p *Pool) map[string]int {
+	ws := make(map[string]int)
+	for _, u := range p.Usage() {
+		ws[u.Name] = u.Workers
+	}
+
+	return ws
+}
+
+func waitBusy(t *testing.T, op *OpOf[int, int], n int) {
+	t.Helper()
+
+	total, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != n*(n+1)/2 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestFairShare(t *testing.T) {
+	p := NewPool(4, nil, nil, OptFairShare())
+	defer p.Cancel()
+
+	var a, b int32
+	opA := startBusy(t, p, 5000, &a, OptTenant("a", 1, 0))
+
+	eventually(t, func() bool { return workers(p)["a"] == 4 })
+
+	// the operation started last gets half of the pool
+	opB := startBusy(t, p, 1000, &b, OptTenant("b", 1, 0))
+
+	eventually(t, func() bool {
+		ws := workers(p)
+		return ws["a"] == 2 && ws["b"] == 2
+	})
+
+	waitBusy(t, opB, 1000)
+
+	// the go routines return to the remaining operation
+	eventually(t, func() bool { return workers(p)["a"] == 4 })
+
+	opA.Cancel()
+	opA.Wait(context.Background())
+}
+
+func TestFairShareWeights(t *testing.T) {
+	p := NewPool(4, nil, nil, OptFairShare())
+	defer p.Cancel()
+
+	var a, b int32
+	opA := startBusy(t, p, 5000, &a, OptTenant("a", 3, 0))
+	opB := startBusy(t, p, 5000, &b, OptTenant("b", 1, 0))
+
+	eventually(t, func() bool {
+		ws := workers(p)
+		return ws["a"] == 3 && ws["b"] == 1
+	})
+
+	if u := p.Usage(); len(u) != 2 || u[0].Name != "a" || u[0].Weight != 3 || u[1].Weight != 1 {
+		t.Error("unexpected usage", u)
+	}
+
+	opA.Cancel()
+	opB.Cancel()
+	opA.Wait(context.Background())
+	opB.Wait(context.Background())
+}
+
+func TestTenantMax(t *testing.T) {
+	// caps apply to pools without OptFairShare
+	p := NewPool(4, nil, nil)
+	defer p.Cancel()
+
+	var a, b int32
+	var peak int32
+	opA := startBusy(t, p, 500, &a, OptTenant("a", 1, 1))
+
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if n := atomic.LoadInt32(&a); n > atomic.LoadInt32(&peak) {
+				atomic.StoreInt32(&peak, n)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	// the rest of the pool is free for other operations
+	opB := startBusy(t, p, 100, &b)
+	waitBusy(t, opB, 100)
+
+	if ws := workers(p); ws["a"] != 1 {
+		t.Error("unexpected workers", ws)
+	}
+
+	waitBusy(t, opA, 500)
+	close(stop)
+
+	if peak := atomic.LoadInt32(&peak); peak > 1 {
+		t.Error("cap exceeded", peak)
+	}
+}
+
+func TestFairShareStealing(t *testing.T) {
+	p := NewPool(4, nil, nil, OptFairShare())
+	defer p.Cancel()
+
+	var a, b int32
+	opA := startBusy(t, p, 2000, &a, OptTenant("a", 1, 0), OptWorkStealing())
+	opB := startBusy(t, p, 200, &b, OptTenant("b", 1, 0), OptWorkStealing())
+
+	waitBusy(t, opB, 200)
+	waitBusy(t, opA, 2000)
+}
+
+func TestTenantInvalid(t *testing.T) {
+	for _, opt := range []Option{OptTenant("a", 0, 0), OptTenant("a", 1, -1)} {
+		if _, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+			return j
+		}, nil, opt); err != ErrOptInvalidValueTenant {
+			t.Error("unexpected error", err)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/redsift/go-parallel
+
+go 1.20
@@ -0,0 +1,430 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	// ErrGraphNode indicates a node of the graph is unknown, has a duplicate name or an invalid queue size
+	ErrGraphNode = errors.New("invalid graph node")
+
+	// ErrGraphCycle indicates the edges of the graph form a cycle
+	ErrGraphCycle = errors.New("graph contains a cycle")
+
+	// ErrGraphDangling indicates a node of the graph other than a source has no inputs,
+	// or a source has inputs
+	ErrGraphDangling = errors.New("graph contains a dangling input")
+)
+
+type nodeKind int
+
+const (
+	nodeSource nodeKind = iota
+	nodeMapper
+	nodeSink
+)
+
+type node struct {
+	name string
+	kind nodeKind
+
+	queue   int
+	mapper  func(init interface{}, job interface{}) (interface{}, error)
+	opts    []Option
+	value   interface{}
+	reducer func(previous interface{}, current interface{}) interface{}
+
+	ins, outs []*edge
+}
+
+type edge struct {
+	from, to *node
+	size     int
+}
+
+// Graph is a directed acyclic graph of named stages. Sources receive submitted jobs, nodes
+// are mapper pools and sinks reduce their inputs. Edges are bounded channels between them,
+// the outputs of a node are sent on every outgoing edge (fan-out) and a node consumes the
+// outputs of every incoming edge (fan-in). The graph shares a single context and the first
+// error or trapped panic of any node cancels the whole graph
+type Graph struct {
+	ctx   context.Context
+	nodes map[string]*node
+	order []*node
+	edges []*edge
+	err   error
+}
+
+// NewGraph returns an empty graph, ctx is used to cancel every node
+func NewGraph(ctx context.Context) *Graph {
+	return &Graph{ctx: ctx, nodes: make(map[string]*node)}
+}
+
+func (g *Graph) add(n *node) *Graph {
+	if _, ok := g.nodes[n.name]; ok {
+		g.fail(fmt.Errorf("%w: duplicate %q", ErrGraphNode, n.name))
+		return g
+	}
+
+	g.nodes[n.name] = n
+	g.order = append(g.order, n)
+
+	return g
+}
+
+func (g *Graph) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// Source adds a named entry point of the graph with a job queue of sz
+func (g *Graph) Source(name string, sz int) *Graph {
+	if sz < 1 {
+		g.fail(fmt.Errorf("%w: queue of %q", ErrGraphNode, name))
+		return g
+	}
+
+	return g.add(&node{name: name, kind: nodeSource, queue: sz})
+}
+
+// Node adds a named mapper pool, opts control the queue size, goroutine pool & `init` values
+// and failure policy of the node. OptContext is ignored as the context of the graph is used
+func (g *Graph) Node(name string, mapper func(init interface{}, job interface{}) (interface{}, error), opts ...Option) *Graph {
+	return g.add(&node{name: name, kind: nodeMapper, mapper: mapper, opts: opts})
+}
+
+// Sink adds a named reducer, value is the initial value of the reducer
+func (g *Graph) Sink(name string, value interface{}, reducer func(previous interface{}, current interface{}) interface{}) *Graph {
+	return g.add(&node{name: name, kind: nodeSink, value: value, reducer: reducer})
+}
+
+// Edge connects the outputs of the node from to the inputs of the node to with a channel of sz
+func (g *Graph) Edge(from, to string, sz int) *Graph {
+	f, ok := g.nodes[from]
+	if !ok {
+		g.fail(fmt.Errorf("%w: unknown %q", ErrGraphNode, from))
+		return g
+	}
+
+	t, ok := g.nodes[to]
+	if !ok {
+		g.fail(fmt.Errorf("%w: unknown %q", ErrGraphNode, to))
+		return g
+	}
+
+	if sz < 0 {
+		g.fail(fmt.Errorf("%w: edge %q to %q", ErrGraphNode, from, to))
+		return g
+	}
+
+	e := &edge{from: f, to: t, size: sz}
+	f.outs = append(f.outs, e)
+	t.ins = append(t.ins, e)
+	g.edges = append(g.edges, e)
+
+	return g
+}
+
+// Validate checks the graph has no cycles and no dangling inputs
+func (g *Graph) Validate() error {
+	if g.err != nil {
+		return g.err
+	}
+
+	for _, n := range g.order {
+		if (n.kind == nodeSource) != (len(n.ins) == 0) {
+			return fmt.Errorf("%w: %q", ErrGraphDangling, n.name)
+		}
+
+		if n.kind == nodeSink && len(n.outs) > 0 {
+			return fmt.Errorf("%w: sink %q has outputs", ErrGraphNode, n.name)
+		}
+	}
+
+	// remove nodes without remaining inputs until none are left
+	ins := make(map[*node]int, len(g.order))
+	var ready []*node
+	for _, n := range g.order {
+		ins[n] = len(n.ins)
+		if len(n.ins) == 0 {
+			ready = append(ready, n)
+		}
+	}
+
+	visited := 0
+	for len(ready) > 0 {
+		n := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		visited++
+
+		for _, e := range n.outs {
+			ins[e.to]--
+			if ins[e.to] == 0 {
+				ready = append(ready, e.to)
+			}
+		}
+	}
+
+	if visited != len(g.order) {
+		return ErrGraphCycle
+	}
+
+	return nil
+}
+
+// GraphRun is a running graph, jobs are submitted to its sources
+type GraphRun struct {
+	sources map[string]*input[interface{}]
+
+	done    chan struct{}
+	results map[string]interface{}
+	err     error
+	cancel  context.CancelCauseFunc
+}
+
+// Start validates and runs the graph
+func (g *Graph) Start() (*GraphRun, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(g.ctx)
+
+	opts := make(map[*node]*options)
+	for _, n := range g.order {
+		if n.kind != nodeMapper {
+			continue
+		}
+
+		o, err := makeOptionsOf[interface{}, interface{}](append(n.opts[:len(n.opts):len(n.opts)], OptContext(ctx)))
+		if err != nil {
+			for _, o := range opts {
+				if o.cancel != nil {
+					o.cancel()
+				}
+			}
+			cancel(err)
+			return nil, err
+		}
+		opts[n] = o
+	}
+
+	run := &GraphRun{
+		sources: make(map[string]*input[interface{}]),
+		done:    make(chan struct{}),
+		results: make(map[string]interface{}),
+		cancel:  cancel,
+	}
+
+	// first is the first error of any node
+	var first error
+	var firstMu sync.Mutex
+	fail := func(err error) {
+		firstMu.Lock()
+		defer firstMu.Unlock()
+
+		if first == nil {
+			first = err
+			cancel(err)
+		}
+	}
+
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+
+	chans := make(map[*edge]chan interface{}, len(g.edges))
+	for _, e := range g.edges {
+		chans[e] = make(chan interface{}, e.size)
+	}
+
+	// emit sends v on every outgoing edge of n
+	emit := func(n *node, v interface{}) {
+		for _, e := range n.outs {
+			select {
+			case chans[e] <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	closeOuts := func(n *node) {
+		for _, e := range n.outs {
+			close(chans[e])
+		}
+	}
+
+	// merge forwards every incoming edge of n to in and closes in once they are all closed
+	merge := func(n *node, in chan interface{}) {
+		var wi sync.WaitGroup
+		wi.Add(len(n.ins))
+
+		for _, e := range n.ins {
+			go func(c chan interface{}) {
+				defer wi.Done()
+
+				for v := range c {
+					select {
+					case in <- v:
+					case <-ctx.Done():
+					}
+				}
+			}(chans[e])
+		}
+
+		go func() {
+			wi.Wait()
+			close(in)
+		}()
+	}
+
+	for _, n := range g.order {
+		n := n
+		wg.Add(1)
+
+		switch n.kind {
+		case nodeSource:
+			in := make(chan interface{}, n.queue)
+			q := newInput(ctx, in)
+			run.sources[n.name] = &q
+
+			// call_source
+			go func() {
+				defer wg.Done()
+				defer closeOuts(n)
+
+				for {
+					select {
+					case v, ok := <-in:
+						if !ok {
+							return
+						}
+						emit(n, v)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+		case nodeMapper:
+			in, _, _ := parallel(opts[n], struct{}{}, n.mapper, func(_ struct{}, r interface{}) struct{} {
+				emit(n, r)
+				return struct{}{}
+			}, func(_ struct{}, err error) {
+				defer wg.Done()
+
+				if err != nil {
+					fail(err)
+				}
+				closeOuts(n)
+			})
+			merge(n, in)
+
+		case nodeSink:
+			in := make(chan interface{}, len(n.ins))
+			merge(n, in)
+
+			// call_reduce
+			go func() {
+				defer wg.Done()
+
+				t := n.value
+				defer func() {
+					if r := recover(); r != nil {
+						fail(ErrTrappedPanics{Panics: []ErrTrappedPanic{{Panic: r, Stack: debug.Stack(), Phase: PhaseReduce, Worker: -1}}})
+
+						// drain the input so the upstream nodes do not block
+						for range in {
+						}
+						return
+					}
+
+					resultsMu.Lock()
+					defer resultsMu.Unlock()
+
+					run.results[n.name] = t
+				}()
+
+				for v := range in {
+					if n.reducer != nil {
+						t = n.reducer(t, v)
+					}
+				}
+			}()
+		}
+	}
+
+	// call_then
+	go func() {
+		wg.Wait()
+
+		if err := ctx.Err(); err != nil {
+			fail(context.Cause(ctx))
+		}
+		cancel(nil)
+
+		if first != nil {
+			run.results = nil
+		}
+		run.err = first
+		close(run.done)
+	}()
+
+	return run, nil
+}
+
+// Submit queues a job on the named source, see Op.Submit for the errors returned
+func (r *GraphRun) Submit(ctx context.Context, source string, job interface{}) error {
+	q, ok := r.sources[source]
+	if !ok {
+		return fmt.Errorf("%w: unknown source %q", ErrGraphNode, source)
+	}
+
+	return q.Submit(ctx, job)
+}
+
+// CloseSource signals that all the jobs of the named source have been submitted
+func (r *GraphRun) CloseSource(source string) error {
+	q, ok := r.sources[source]
+	if !ok {
+		return fmt.Errorf("%w: unknown source %q", ErrGraphNode, source)
+	}
+
+	q.CloseInput()
+	return nil
+}
+
+// CloseInput closes every source, the graph shuts down in order once the nodes have
+// consumed all their inputs
+func (r *GraphRun) CloseInput() {
+	for _, q := range r.sources {
+		q.CloseInput()
+	}
+}
+
+// Wait blocks until every node of the graph completes and returns the final output of every
+// sink by name and/or the first error of any node. If ctx ends first, the graph is left running
+// and the error of ctx is returned
+func (r *GraphRun) Wait(ctx context.Context) (map[string]interface{}, error) {
+	select {
+	case <-r.done:
+		return r.results, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed when every node of the graph completes
+func (r *GraphRun) Done() <-chan struct{} {
+	return r.done
+}
+
+// Cancel stops every node of the graph and Wait returns context.Canceled
+func (r *GraphRun) Cancel() {
+	r.cancel(nil)
+}
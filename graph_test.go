@@ -0,0 +1,181 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func addAny(p interface{}, c interface{}) interface{} {
+	return p.(int) + c.(int)
+}
+
+func countAny(p interface{}, _ interface{}) interface{} {
+	return p.(int) + 1
+}
+
+func TestGraph(t *testing.T) {
+	m, c := OptMappers(2, nil, nil)
+	defer c()
+
+	g := NewGraph(context.Background()).
+		Source("nums", 10).
+		Node("double", func(_ interface{}, j interface{}) (interface{}, error) {
+			return j.(int) * 2, nil
+		}, m).
+		Node("square", func(_ interface{}, j interface{}) (interface{}, error) {
+			return j.(int) * j.(int), nil
+		}).
+		Sink("count", 0, countAny).
+		Sink("sum", 0, addAny).
+		Edge("nums", "double", 1).
+		Edge("nums", "square", 0).
+		Edge("nums", "count", 5).
+		Edge("double", "sum", 5).
+		Edge("square", "sum", 5)
+
+	run, err := g.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := run.Submit(context.Background(), "nums", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := run.CloseSource("nums"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := run.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res["count"] != 10 {
+		t.Error("unexpected count", res["count"])
+	}
+
+	// 2 * 55 + 385
+	if res["sum"] != 495 {
+		t.Error("unexpected sum", res["sum"])
+	}
+}
+
+func TestGraphValidate(t *testing.T) {
+	noop := func(_ interface{}, j interface{}) (interface{}, error) {
+		return j, nil
+	}
+
+	for _, test := range []struct {
+		g   *Graph
+		err error
+	}{
+		{NewGraph(context.Background()).Source("a", 1).Source("a", 1), ErrGraphNode},
+		{NewGraph(context.Background()).Source("a", 1).Edge("a", "b", 1), ErrGraphNode},
+		{NewGraph(context.Background()).Source("a", 0), ErrGraphNode},
+		{NewGraph(context.Background()).Source("a", 1).Sink("b", 0, addAny), ErrGraphDangling},
+		{NewGraph(context.Background()).Source("a", 1).Node("b", noop).Edge("b", "a", 1), ErrGraphDangling},
+		{NewGraph(context.Background()).Source("a", 1).Sink("b", 0, addAny).Node("c", noop).
+			Edge("a", "b", 1).Edge("b", "c", 1), ErrGraphNode},
+		{NewGraph(context.Background()).Source("a", 1).Node("b", noop).Node("c", noop).
+			Edge("a", "b", 1).Edge("b", "c", 1).Edge("c", "b", 1), ErrGraphCycle},
+		{NewGraph(context.Background()).Source("a", 1).Node("b", noop).Edge("a", "b", 1).Edge("b", "b", 1), ErrGraphCycle},
+		{NewGraph(context.Background()).Source("a", 1).Node("b", noop).Edge("a", "b", 1), nil},
+	} {
+		if err := test.g.Validate(); !errors.Is(err, test.err) {
+			t.Error("unexpected error", err, test.err)
+		}
+	}
+}
+
+func TestGraphError(t *testing.T) {
+	run, err := NewGraph(context.Background()).
+		Source("nums", 1).
+		Node("fail", func(_ interface{}, j interface{}) (interface{}, error) {
+			if j.(int) == 5 {
+				return nil, errOdd
+			}
+			return j, nil
+		}).
+		Sink("sum", 0, addAny).
+		Sink("count", 0, countAny).
+		Edge("nums", "fail", 1).
+		Edge("nums", "count", 1).
+		Edge("fail", "sum", 1).
+		Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if err := run.Submit(context.Background(), "nums", i); err != nil {
+			if !errors.Is(err, errOdd) {
+				t.Error("unexpected error", err)
+			}
+			break
+		}
+	}
+	run.CloseInput()
+
+	if _, err := run.Wait(context.Background()); err != errOdd {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestGraphPanic(t *testing.T) {
+	run, err := NewGraph(context.Background()).
+		Source("nums", 1).
+		Sink("sum", 0, func(p interface{}, c interface{}) interface{} {
+			panic("junk")
+		}).
+		Edge("nums", "sum", 1).
+		Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := run.Submit(context.Background(), "nums", i); err != nil {
+			break
+		}
+	}
+	run.CloseInput()
+
+	_, err = run.Wait(context.Background())
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) || pnk.Panic != "junk" || pnk.Phase != PhaseReduce {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestGraphCancel(t *testing.T) {
+	run, err := NewGraph(context.Background()).
+		Source("nums", 1).
+		Node("noop", func(_ interface{}, j interface{}) (interface{}, error) {
+			return j, nil
+		}).
+		Sink("sum", 0, addAny).
+		Edge("nums", "noop", 1).
+		Edge("noop", "sum", 1).
+		Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run.Cancel()
+
+	if err := run.Submit(context.Background(), "nums", 1); !errors.Is(err, ErrOpCancelled) {
+		t.Error("unexpected error", err)
+	}
+
+	if err := run.Submit(context.Background(), "junk", 1); !errors.Is(err, ErrGraphNode) {
+		t.Error("unexpected error", err)
+	}
+
+	if _, err := run.Wait(context.Background()); err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
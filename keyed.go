@@ -0,0 +1,331 @@
+package parallel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"reflect"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrOptInvalidValuePartitions indicates the number of partitions for a keyed operation is invalid
+var ErrOptInvalidValuePartitions = errors.New("invalid option value: partitions")
+
+// KeyValue is the reduced value of a key
+type KeyValue[K comparable, A any] struct {
+	Key   K
+	Value A
+}
+
+// OptPartitions sets the number of reducer go routines of MapReduceByKey, each key is
+// reduced by the partition selected by its hash. Defaults to the number of mapper go routines
+func OptPartitions(sz int) Option {
+	return func(o *options) error {
+		if sz < 1 {
+			return ErrOptInvalidValuePartitions
+		}
+		o.partitions = sz
+		return nil
+	}
+}
+
+// MapReduceByKey performs a map/reduce where every key is reduced independently
+//
+// value: is the initial value of the reducer for every key
+// mapper: functions are called in multiple goroutines, they consume jobs and call emit with zero or more key/value pairs,
+// the pairs are discarded if the mapper returns an error
+// reducer: functions are called synchronously for each key and returns the value for `previous` for the next invocation
+// then: receives the last output produced by the reducer of every key
+// opts: control context, queue sizes, goroutine pool & `init` values for mappers, failures & partitions
+//
+// The returned channel is the job queue and must be closed by the caller when all jobs have been submitted
+func MapReduceByKey[S, J any, K comparable, V, A any](value A,
+	mapper func(init S, job J, emit func(K, V)) error,
+	reducer func(previous A, current V) A,
+	then func(final map[K]A, err error),
+	opts ...Option) (chan J, error) {
+
+	o, err := makeOptionsOf[S, struct{}](opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapReduceByKey(o, value, mapper, reducer, func(parts []map[K]A, err error) {
+		if then == nil {
+			return
+		}
+
+		if parts == nil {
+			then(nil, err)
+			return
+		}
+
+		sz := 0
+		for _, p := range parts {
+			sz += len(p)
+		}
+
+		final := make(map[K]A, sz)
+		for _, p := range parts {
+			for k, v := range p {
+				final[k] = v
+			}
+		}
+
+		then(final, err)
+	}), nil
+}
+
+// MapReduceByKeyStream is the equivalent of MapReduceByKey that streams the reduced value of
+// every key once all the jobs have been mapped and reduced
+//
+// The `in` channel is the job queue and must be closed by the caller when all jobs have been
+// submitted, `out` is closed once every key has been sent. Any error during the operation, including
+// invalid options, is then sent to `errc` before it is closed
+func MapReduceByKeyStream[S, J any, K comparable, V, A any](value A,
+	mapper func(init S, job J, emit func(K, V)) error,
+	reducer func(previous A, current V) A,
+	opts ...Option) (in chan<- J, out <-chan KeyValue[K, A], errc <-chan error) {
+
+	ec := make(chan error, 1)
+
+	o, err := makeOptionsOf[S, struct{}](opts)
+	if err != nil {
+		// accept and discard jobs so the caller does not block
+		q := make(chan J)
+		go func() {
+			for range q {
+			}
+		}()
+
+		oc := make(chan KeyValue[K, A])
+		close(oc)
+
+		ec <- err
+		close(ec)
+
+		return q, oc, ec
+	}
+
+	oc := make(chan KeyValue[K, A], o.queue)
+	cls := o.ctx.Done()
+
+	q := mapReduceByKey(o, value, mapper, reducer, func(parts []map[K]A, err error) {
+		defer func() {
+			close(oc)
+
+			if err != nil {
+				ec <- err
+			}
+			close(ec)
+		}()
+
+		for _, p := range parts {
+			for k, v := range p {
+				select {
+				case oc <- KeyValue[K, A]{k, v}:
+				case <-cls:
+					return
+				}
+			}
+		}
+	})
+
+	return q, oc, ec
+}
+
+// hashOf hashes a key so that keys that are equal have the same hash, the common key types
+// are hashed directly and the others by walking their value, see hashValue
+func hashOf[K comparable](seed maphash.Seed, k K) uint64 {
+	var h maphash.Hash
+	h.SetSeed(seed)
+
+	switch v := interface{}(k).(type) {
+	case string:
+		h.WriteString(v)
+	case bool:
+		hashBool(&h, v)
+	case int:
+		hashUint(&h, uint64(v))
+	case int8:
+		hashUint(&h, uint64(v))
+	case int16:
+		hashUint(&h, uint64(v))
+	case int32:
+		hashUint(&h, uint64(v))
+	case int64:
+		hashUint(&h, uint64(v))
+	case uint:
+		hashUint(&h, uint64(v))
+	case uint8:
+		hashUint(&h, uint64(v))
+	case uint16:
+		hashUint(&h, uint64(v))
+	case uint32:
+		hashUint(&h, uint64(v))
+	case uint64:
+		hashUint(&h, v)
+	case uintptr:
+		hashUint(&h, uint64(v))
+	case float32:
+		hashFloat(&h, float64(v))
+	case float64:
+		hashFloat(&h, v)
+	default:
+		hashValue(&h, reflect.ValueOf(k))
+	}
+
+	return h.Sum64()
+}
+
+// hashValue hashes the fields of structs, the elements of arrays and the dynamic values of
+// interfaces in turn. Pointers and channels are hashed by address as they are compared by
+// address, not by the value they point to
+func hashValue(h *maphash.Hash, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		// a nil interface
+		hashUint(h, 0)
+	case reflect.String:
+		h.WriteString(v.String())
+	case reflect.Bool:
+		hashBool(h, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		hashUint(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		hashUint(h, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		hashFloat(h, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		hashFloat(h, real(c))
+		hashFloat(h, imag(c))
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		hashUint(h, uint64(v.Pointer()))
+	case reflect.Interface:
+		hashValue(h, v.Elem())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(h, v.Field(i))
+		}
+	default:
+		// func, map and slice values can not be keys
+		panic(fmt.Sprintf("unhashable key type %v", v.Type()))
+	}
+}
+
+func hashUint(h *maphash.Hash, u uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], u)
+	h.Write(b[:])
+}
+
+func hashBool(h *maphash.Hash, b bool) {
+	if b {
+		h.WriteByte(1)
+	} else {
+		h.WriteByte(0)
+	}
+}
+
+// hashFloat hashes f, -0 and 0 are the same key
+func hashFloat(h *maphash.Hash, f float64) {
+	if f == 0 {
+		f = 0
+	}
+	hashUint(h, math.Float64bits(f))
+}
+
+// pair is a key/value emitted by a mapper
+type pair[K comparable, V any] struct {
+	key K
+	v   V
+}
+
+// mapReduceByKey shuffles the pairs emitted by the mappers to o.partitions reducer go routines
+// by the hash of their key, done receives the reduced keys of every partition or nil on error
+func mapReduceByKey[S, J any, K comparable, V, A any](o *options, value A,
+	mapper func(init S, job J, emit func(K, V)) error,
+	reducer func(previous A, current V) A,
+	done func(parts []map[K]A, err error)) chan J {
+
+	sz := o.partitions
+	if sz == 0 {
+		sz = o.mapper.size()
+	}
+
+	seed := maphash.MakeSeed()
+	shuffle := make([]chan pair[K, V], sz)
+	parts := make([]map[K]A, sz)
+
+	var trapped panics
+
+	var wp sync.WaitGroup
+	wp.Add(sz)
+
+	for i := range shuffle {
+		shuffle[i] = make(chan pair[K, V], o.mapper.size())
+		parts[i] = make(map[K]A)
+
+		// call_reduce
+		go func(in chan pair[K, V], part map[K]A) {
+			defer func() {
+				if r := recover(); r != nil {
+					trapped.trap(ErrTrappedPanic{Panic: r, Stack: debug.Stack(), Phase: PhaseReduce, Worker: -1})
+				}
+				wp.Done()
+
+				// drain the partition so the mappers do not block
+				for range in {
+				}
+			}()
+
+			for p := range in {
+				t, ok := part[p.key]
+				if !ok {
+					t = value
+				}
+				part[p.key] = reducer(t, p.v)
+			}
+		}(shuffle[i], parts[i])
+	}
+
+	in, _, _ := parallel(o, struct{}{}, func(s S, j J) (struct{}, error) {
+		// the pairs of a job are only shuffled once its mapper succeeds
+		var pairs []pair[K, V]
+		err := mapper(s, j, func(k K, v V) {
+			pairs = append(pairs, pair[K, V]{k, v})
+		})
+		if err != nil {
+			return struct{}{}, err
+		}
+
+		for _, p := range pairs {
+			shuffle[hashOf(seed, p.key)%uint64(sz)] <- p
+		}
+		return struct{}{}, nil
+	}, nil, func(_ struct{}, err error) {
+		for _, c := range shuffle {
+			close(c)
+		}
+		wp.Wait()
+
+		var multi ErrMulti
+		if pnk := trapped.get(); pnk != nil {
+			done(nil, pnk)
+		} else if err != nil && !errors.As(err, &multi) {
+			done(nil, err)
+		} else {
+			done(parts, err)
+		}
+	})
+
+	return in
+}
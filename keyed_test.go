@@ -0,0 +1,305 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testText = []string{
+	"the quick brown fox",
+	"jumps over the lazy dog",
+	"the dog sleeps",
+}
+
+func words(_ interface{}, line string, emit func(string, int)) error {
+	for _, w := range strings.Fields(line) {
+		emit(w, 1)
+	}
+	return nil
+}
+
+func TestMapReduceByKey(t *testing.T) {
+	for _, partitions := range []int{1, 3, 16} {
+		var counts map[string]int
+		var cerr error
+		done := make(chan struct{})
+
+		q, err := MapReduceByKey(0, words, func(p int, c int) int {
+			return p + c
+		}, func(final map[string]int, err error) {
+			counts, cerr = final, err
+			close(done)
+		}, OptPartitions(partitions))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, l := range testText {
+			q <- l
+		}
+		close(q)
+
+		<-done
+
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+
+		if len(counts) != 9 || counts["the"] != 3 || counts["dog"] != 2 || counts["fox"] != 1 {
+			t.Error("unexpected counts", partitions, counts)
+		}
+	}
+}
+
+func TestMapReduceByKeyIndex(t *testing.T) {
+	in, out, errc := MapReduceByKeyStream(nil, func(_ interface{}, line int, emit func(string, int)) error {
+		for _, w := range strings.Fields(testText[line]) {
+			emit(w, line)
+		}
+		return nil
+	}, func(p []int, c int) []int {
+		return append(p, c)
+	})
+
+	for i := range testText {
+		in <- i
+	}
+	close(in)
+
+	index := make(map[string][]int)
+	for kv := range out {
+		sort.Ints(kv.Value)
+		index[kv.Key] = kv.Value
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if l := index["the"]; len(l) != 3 || l[0] != 0 || l[1] != 1 || l[2] != 2 {
+		t.Error("unexpected index", l)
+	}
+
+	if l := index["dog"]; len(l) != 2 || l[0] != 1 || l[1] != 2 {
+		t.Error("unexpected index", l)
+	}
+}
+
+func TestMapReduceByKeyErrors(t *testing.T) {
+	done := make(chan struct{})
+
+	q, err := MapReduceByKey(0, func(_ interface{}, line string, emit func(string, int)) error {
+		if strings.Contains(line, "dog") {
+			return errOdd
+		}
+		return words(nil, line, emit)
+	}, func(p int, c int) int {
+		return p + c
+	}, func(final map[string]int, err error) {
+		if err != errOdd || final != nil {
+			t.Error("unexpected result", final, err)
+		}
+		close(done)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range testText {
+		q <- l
+	}
+	close(q)
+
+	<-done
+}
+
+func TestMapReduceByKeySkip(t *testing.T) {
+	for _, policy := range []FailurePolicy{SkipAndContinue, CollectAll} {
+		var counts map[string]int
+		var cerr error
+		done := make(chan struct{})
+
+		q, err := MapReduceByKey(0, func(_ interface{}, i int, emit func(string, int)) error {
+			emit("a", 1)
+			if i%2 == 1 {
+				return errOdd
+			}
+			return nil
+		}, func(p int, c int) int {
+			return p + c
+		}, func(final map[string]int, err error) {
+			counts, cerr = final, err
+			close(done)
+		}, OptFailure(policy))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 10; i++ {
+			q <- i
+		}
+		close(q)
+
+		<-done
+
+		if counts["a"] != 5 {
+			t.Error("unexpected counts", policy, counts, cerr)
+		}
+	}
+}
+
+func TestMapReduceByKeyHash(t *testing.T) {
+	type key struct {
+		a string
+		b int
+		f float32
+		i interface{}
+		p *int
+	}
+
+	seed := maphash.MakeSeed()
+	negZero := math.Copysign(0, -1)
+	x := 1
+
+	for _, keys := range [][2]interface{}{
+		{"x", "x"},
+		{int8(-1), int8(-1)},
+		{true, true},
+		{0.0, negZero},
+		{float32(0), float32(negZero)},
+		{[2]float64{1, 0}, [2]float64{1, negZero}},
+		{key{"x", 1, 0, 0.0, &x}, key{"x", 1, float32(negZero), negZero, &x}},
+		{complex(0, 0), complex(negZero, negZero)},
+		{nil, nil},
+	} {
+		if keys[0] != keys[1] {
+			t.Fatal("unequal keys", keys)
+		}
+
+		if hashOf(seed, keys[0]) != hashOf(seed, keys[1]) {
+			t.Error("unequal hashes for equal keys", keys)
+		}
+	}
+
+	if hashOf(seed, &x) == hashOf(seed, new(int)) {
+		t.Error("equal hashes for pointers to different variables")
+	}
+}
+
+func TestMapReduceByKeyHashKeys(t *testing.T) {
+	type node struct {
+		name string
+	}
+
+	// the pointee of a pointer key changes while it is reduced
+	n := &node{"a"}
+	var mu sync.Mutex
+
+	var counts map[*node]int
+	done := make(chan struct{})
+
+	q, err := MapReduceByKey(0, func(_ interface{}, j int, emit func(*node, int)) error {
+		mu.Lock()
+		n.name = strconv.Itoa(j)
+		mu.Unlock()
+
+		emit(n, 1)
+		return nil
+	}, func(p int, c int) int {
+		return p + c
+	}, func(final map[*node]int, err error) {
+		counts = final
+		close(done)
+	}, OptPartitions(16))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		q <- i
+	}
+	close(q)
+	<-done
+
+	if len(counts) != 1 || counts[n] != 100 {
+		t.Error("unexpected counts", counts)
+	}
+
+	type zero struct {
+		f float64
+	}
+
+	var zeros map[zero]int
+	done = make(chan struct{})
+
+	qz, err := MapReduceByKey(0, func(_ interface{}, j int, emit func(zero, int)) error {
+		if j%2 == 0 {
+			emit(zero{math.Copysign(0, -1)}, 1)
+		} else {
+			emit(zero{0}, 1)
+		}
+		return nil
+	}, func(p int, c int) int {
+		return p + c
+	}, func(final map[zero]int, err error) {
+		zeros = final
+		close(done)
+	}, OptPartitions(16))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		qz <- i
+	}
+	close(qz)
+	<-done
+
+	if len(zeros) != 1 || zeros[zero{0}] != 1000 {
+		t.Error("unexpected counts", zeros)
+	}
+}
+
+func TestMapReduceByKeyPanic(t *testing.T) {
+	in, out, errc := MapReduceByKeyStream(0, words, func(p int, c int) int {
+		panic("junk")
+	}, OptContext(context.Background()))
+
+	for _, l := range testText {
+		in <- l
+	}
+	close(in)
+
+	for range out {
+		t.Error("unexpected output")
+	}
+
+	err := <-errc
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) || pnk.Panic != "junk" {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestMapReduceByKeyInvalid(t *testing.T) {
+	_, err := MapReduceByKey(0, words, func(p int, c int) int {
+		return p + c
+	}, nil, OptPartitions(0))
+
+	if err != ErrOptInvalidValuePartitions {
+		t.Error("unexpected error", err)
+	}
+}
@@ -0,0 +1,176 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrOptInvalidValueLimiter indicates the limiter is nil or its bounds are invalid
+var ErrOptInvalidValueLimiter = errors.New("invalid option value: limiter")
+
+const (
+	// limiterWindow is the least number of samples in a window of the limiter
+	limiterWindow = 10
+	// limiterReset is the number of windows after which the baseline latency is reset
+	// so the limiter can follow a drift in the latency of the mappers
+	limiterReset = 100
+	// limiterSmoothing weights the new limit against the current one at the end of a window
+	limiterSmoothing = 0.5
+)
+
+// Limiter adapts the number of mapper go routines that map jobs concurrently from the observed
+// latency of the mappers. The limit starts at min and grows while the latency stays close to the
+// lowest latency seen, once the mappers slow down as they contend for a resource the limit is
+// reduced in proportion. A Limiter may be shared by operations that use the same resource
+type Limiter struct {
+	min, max int
+
+	// mu guards the fields below, cond is signalled when a job completes
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    float64
+	inflight int
+
+	// samples of the current window
+	samples int
+	sum     time.Duration
+	peak    int
+	start   time.Time
+
+	baseline time.Duration
+	windows  int
+	stats    LimiterStats
+}
+
+// LimiterStats is a snapshot of a Limiter, Latency and Throughput are measured over the
+// last complete window of samples
+type LimiterStats struct {
+	Limit      int
+	InFlight   int
+	Latency    time.Duration
+	Baseline   time.Duration
+	Throughput float64
+}
+
+// NewLimiter returns a Limiter that keeps between min and max jobs in flight
+func NewLimiter(min, max int) *Limiter {
+	l := &Limiter{min: min, max: max, limit: float64(min), start: time.Now()}
+	l.cond = sync.NewCond(&l.mu)
+
+	return l
+}
+
+// OptLimiter limits the number of jobs mapped concurrently with l. When no OptMappers is
+// supplied the operation starts max go routines instead of runtime.NumCPU(), with a smaller
+// pool the limit is effectively capped by the size of the pool. Jobs wait for the limiter
+// before OptJobTimeout starts timing them
+func OptLimiter(l *Limiter) Option {
+	return func(o *options) error {
+		if l == nil || l.min < 1 || l.max < l.min {
+			return ErrOptInvalidValueLimiter
+		}
+		o.limiter = l
+		return nil
+	}
+}
+
+// Limit returns the current number of jobs that may be mapped concurrently
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+// Stats returns a snapshot of the limiter
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.stats
+	s.Limit, s.InFlight = int(l.limit), l.inflight
+
+	return s
+}
+
+// acquire blocks until a job may be mapped, it returns false without waiting
+// further once done is closed
+func (l *Limiter) acquire(done <-chan struct{}) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.inflight >= int(l.limit) {
+		select {
+		case <-done:
+			return false
+		default:
+		}
+
+		l.cond.Wait()
+	}
+
+	l.inflight++
+	if l.inflight > l.peak {
+		l.peak = l.inflight
+	}
+
+	return true
+}
+
+// release records the latency of a job that was mapped
+func (l *Limiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	l.samples++
+	l.sum += latency
+
+	if l.samples < limiterWindow || l.samples < int(l.limit) {
+		l.cond.Signal()
+		return
+	}
+
+	now := time.Now()
+	short := l.sum / time.Duration(l.samples)
+
+	l.windows++
+	if l.baseline == 0 || short < l.baseline || l.windows%limiterReset == 0 {
+		l.baseline = short
+	}
+
+	// the gradient is 1 while the latency is at the baseline and drops as the
+	// mappers queue for a shared resource, the square root allows some queueing
+	// so the limit keeps probing for more concurrency
+	gradient := math.Max(0.5, math.Min(1, float64(l.baseline)/float64(short)))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+
+	// only grow if the current limit was reached during the window
+	if next > l.limit && l.peak < int(l.limit) {
+		next = l.limit
+	}
+
+	l.limit = math.Max(float64(l.min), math.Min(float64(l.max), l.limit*(1-limiterSmoothing)+next*limiterSmoothing))
+
+	l.stats = LimiterStats{
+		Latency:    short,
+		Baseline:   l.baseline,
+		Throughput: float64(l.samples) / now.Sub(l.start).Seconds(),
+	}
+	l.samples, l.sum, l.peak, l.start = 0, 0, l.inflight, now
+
+	l.cond.Broadcast()
+}
+
+// wake unblocks the go routines of an operation waiting in acquire once ctx ends
+func (l *Limiter) wake(ctx context.Context) {
+	<-ctx.Done()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cond.Broadcast()
+}
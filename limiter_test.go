@@ -0,0 +1,151 @@
+package parallel
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// runLimited maps n jobs that take latency(active) with at most max go routines
+func runLimited(t *testing.T, l *Limiter, n int, latency func(active int32) time.Duration) {
+	t.Helper()
+
+	var active, peak int32
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		a := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+
+		for p := atomic.LoadInt32(&peak); a > p && !atomic.CompareAndSwapInt32(&peak, p, a); p = atomic.LoadInt32(&peak) {
+		}
+
+		time.Sleep(latency(a))
+		return 1
+	}, func(p int, c int) int {
+		return p + c
+	}, OptLimiter(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	total, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != n {
+		t.Error("total incorrect", total)
+	}
+
+	if int(peak) > l.max {
+		t.Error("limit exceeded", peak)
+	}
+}
+
+func TestLimiterGrows(t *testing.T) {
+	l := NewLimiter(1, 32)
+
+	// latency does not depend on concurrency, as for I/O bound mappers
+	runLimited(t, l, 3000, func(int32) time.Duration {
+		return time.Millisecond
+	})
+
+	if st := l.Stats(); st.Limit < 16 || st.InFlight != 0 || st.Throughput <= 0 {
+		t.Error("unexpected stats", st)
+	}
+}
+
+func TestLimiterShrinks(t *testing.T) {
+	l := NewLimiter(1, 64)
+
+	// a resource that serves 4 mappers at a time
+	runLimited(t, l, 2000, func(active int32) time.Duration {
+		return time.Duration((active+3)/4) * time.Millisecond
+	})
+
+	if st := l.Stats(); st.Limit > 16 {
+		t.Error("unexpected stats", st)
+	}
+}
+
+func TestLimiterInvalid(t *testing.T) {
+	for _, l := range []*Limiter{nil, NewLimiter(0, 1), NewLimiter(2, 1)} {
+		if _, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+			return j
+		}, nil, OptLimiter(l)); err != ErrOptInvalidValueLimiter {
+			t.Error("unexpected error", err)
+		}
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	l := NewLimiter(1, 1)
+
+	m, c := OptMappers(4, nil, nil)
+	defer c()
+
+	block := make(chan struct{})
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		<-block
+		return j
+	}, nil, OptLimiter(l), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eventually(t, func() bool { return l.Stats().InFlight == 1 })
+
+	// the go routines waiting for the limiter skip their jobs
+	op.Cancel()
+	close(block)
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestLimiterJobTimeout(t *testing.T) {
+	m, c := OptMappers(4, nil, nil)
+	defer c()
+
+	// the jobs waiting for the limiter do not time out
+	op, err := StartCtxOf(0, func(ctx context.Context, _ interface{}, j int) (int, error) {
+		time.Sleep(30 * time.Millisecond)
+		return 1, ctx.Err()
+	}, func(p int, c int) int {
+		return p + c
+	}, OptLimiter(NewLimiter(1, 1)), OptJobTimeout(50*time.Millisecond), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	total, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 4 {
+		t.Error("total incorrect", total)
+	}
+}
@@ -0,0 +1,72 @@
+package parallel
+
+import (
+	"context"
+)
+
+// chunk is a half open range of loop indices
+type chunk struct {
+	lo, hi int
+}
+
+// chunksPerMapper is the number of chunks each mapper go routine receives
+// when the grain of a loop is chosen automatically
+const chunksPerMapper = 4
+
+// For calls fn for every index in [start, end) using the mapper go routines, the range is
+// split into chunks of grain indices (chosen automatically if grain < 1) that are each run
+// on a single go routine. The first error returned by fn or trapped panic is returned,
+// remaining chunks are skipped. opts control the goroutine pool & `init` values passed to fn
+func For(ctx context.Context, start, end, grain int, fn func(init interface{}, i int) error, opts ...Option) error {
+	if end <= start {
+		return nil
+	}
+
+	o, err := makeOptionsOf[interface{}, struct{}](append([]Option{OptContext(ctx)}, opts...))
+	if err != nil {
+		return err
+	}
+
+	if grain < 1 {
+		grain = (end - start) / (o.mapper.size() * chunksPerMapper)
+		if grain < 1 {
+			grain = 1
+		}
+	}
+
+	errc := make(chan error, 1)
+	in, _, _ := parallel(o, struct{}{}, func(s interface{}, c chunk) (struct{}, error) {
+		for i := c.lo; i < c.hi; i++ {
+			if err := fn(s, i); err != nil {
+				return struct{}{}, err
+			}
+		}
+		return struct{}{}, nil
+	}, nil, func(_ struct{}, err error) {
+		errc <- err
+	})
+
+	for lo := start; ; lo += grain {
+		hi := lo + grain
+		if hi > end || hi < lo {
+			hi = end
+		}
+		in <- chunk{lo, hi}
+
+		// lo + grain may overflow past the last chunk
+		if hi == end {
+			break
+		}
+	}
+	close(in)
+
+	return <-errc
+}
+
+// ForEach calls fn for every item of the slice using the mapper go routines, it is
+// equivalent to For over the indices of the slice with an automatic grain
+func ForEach[T any](ctx context.Context, items []T, fn func(init interface{}, item T) error, opts ...Option) error {
+	return For(ctx, 0, len(items), 0, func(s interface{}, i int) error {
+		return fn(s, items[i])
+	}, opts...)
+}
@@ -0,0 +1,99 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFor(t *testing.T) {
+	for _, grain := range []int{0, 1, 7, 1000} {
+		seen := make([]int32, 100)
+
+		err := For(context.Background(), 0, 100, grain, func(_ interface{}, i int) error {
+			atomic.AddInt32(&seen[i], 1)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, v := range seen {
+			if v != 1 {
+				t.Fatal("index visited", v, "times", i, grain)
+			}
+		}
+	}
+}
+
+func TestForMaxInt(t *testing.T) {
+	var n int32
+	err := For(context.Background(), math.MaxInt-10, math.MaxInt, 3, func(_ interface{}, i int) error {
+		atomic.AddInt32(&n, 1)
+		return nil
+	})
+
+	if err != nil || n != 10 {
+		t.Error("unexpected result", n, err)
+	}
+}
+
+func TestForError(t *testing.T) {
+	err := For(context.Background(), -50, 50, 1, func(_ interface{}, i int) error {
+		if i == 0 {
+			return errOdd
+		}
+		return nil
+	})
+
+	if err != errOdd {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestForPanic(t *testing.T) {
+	err := For(context.Background(), 0, 10, 0, func(_ interface{}, i int) error {
+		panic("junk")
+	})
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) || pnk.Panic != "junk" {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestForCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := For(ctx, 0, 1000, 1, func(_ interface{}, i int) error {
+		return nil
+	})
+
+	if err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestForEachMappers(t *testing.T) {
+	m, c := OptMappers(3, func(i int) interface{} {
+		return new(int64)
+	}, nil)
+	defer c()
+
+	var total int64
+	err := ForEach(context.Background(), []int64{1, 2, 3, 4, 5}, func(s interface{}, v int64) error {
+		*s.(*int64) += v
+		atomic.AddInt64(&total, v)
+		return nil
+	}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 15 {
+		t.Error("total incorrect", total)
+	}
+}
@@ -0,0 +1,63 @@
+package parallel
+
+// Map streams the output of the mapper instead of reducing it
+//
+// mapper: functions are called in multiple goroutines, they consume jobs and return the values sent to `out`
+// opts: control context, queue sizes, goroutine pool & `init` values for mappers
+//
+// The `in` channel is the job queue and must be closed by the caller when all jobs have been submitted,
+// `out` is closed once all the jobs have been mapped. Any error during the operation, including invalid
+// options, is then sent to `errc` before it is closed. The caller must consume `out` until it is closed or
+// cancel the context supplied with OptContext
+func Map(mapper func(init interface{}, job interface{}) interface{},
+	opts ...Option) (in chan<- interface{}, out <-chan interface{}, errc <-chan error) {
+
+	return MapOf(mapper, opts...)
+}
+
+// MapOf is the typed equivalent of Map
+func MapOf[S, J, R any](mapper func(init S, job J) R,
+	opts ...Option) (in chan<- J, out <-chan R, errc <-chan error) {
+
+	ec := make(chan error, 1)
+
+	o, err := makeOptionsOf[S, R](opts)
+	if err != nil {
+		// accept and discard jobs so the caller does not block
+		q := make(chan J)
+		go func() {
+			for range q {
+			}
+		}()
+
+		oc := make(chan R)
+		close(oc)
+
+		ec <- err
+		close(ec)
+
+		return q, oc, ec
+	}
+
+	oc := make(chan R, o.queue)
+	cls := o.ctx.Done()
+
+	q, _, _ := parallel(o, struct{}{}, func(s S, j J) (R, error) {
+		return mapper(s, j), nil
+	}, func(_ struct{}, r R) struct{} {
+		select {
+		case oc <- r:
+		case <-cls:
+		}
+		return struct{}{}
+	}, func(_ struct{}, err error) {
+		close(oc)
+
+		if err != nil {
+			ec <- err
+		}
+		close(ec)
+	})
+
+	return q, oc, ec
+}
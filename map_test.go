@@ -0,0 +1,120 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	in, out, errc := MapOf(func(_ interface{}, j int) int {
+		return j * 2
+	})
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+
+	total, count := 0, 0
+	for v := range out {
+		total += v
+		count++
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 100 || total != 9900 {
+		t.Error("unexpected output", count, total)
+	}
+}
+
+func TestMapOrdered(t *testing.T) {
+	in, out, errc := Map(func(_ interface{}, j interface{}) interface{} {
+		return j
+	}, OptOrdered())
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+
+	i := 0
+	for v := range out {
+		if v.(int) != i {
+			t.Fatal("out of order", i, v)
+		}
+		i++
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapPanic(t *testing.T) {
+	in, out, errc := Map(func(_ interface{}, j interface{}) interface{} {
+		panic("junk")
+	})
+
+	for _, v := range []int{0, 1, 2, -1} {
+		in <- v
+	}
+	close(in)
+
+	for range out {
+	}
+
+	err := <-errc
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) || pnk.Panic != "junk" {
+		t.Error("unexpected value trapped", err)
+	}
+}
+
+func TestMapCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	in, out, errc := Map(func(_ interface{}, j interface{}) interface{} {
+		return j
+	}, OptContext(ctx))
+
+	in <- 1
+	<-out
+	cancel()
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+
+	if err := <-errc; err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestMapInvalidOption(t *testing.T) {
+	in, out, errc := Map(func(_ interface{}, j interface{}) interface{} {
+		return j
+	}, OptQueue(0))
+
+	in <- 1
+	close(in)
+
+	for range out {
+		t.Error("unexpected output")
+	}
+
+	if err := <-errc; err != ErrOptInvalidValueQueue {
+		t.Error("unexpected error", err)
+	}
+}
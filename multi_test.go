@@ -1,12 +1,14 @@
 package parallel
 
 import (
+	"context"
 	"math"
 	"math/rand"
 	"testing"
 
 	"fmt"
 	"runtime"
+	"time"
 
 	"github.com/redsift/go-parallel/reducers"
 )
@@ -89,6 +91,87 @@ func BenchmarkWithParallelOverhead(b *testing.B) {
 	}
 }
 
+// BenchmarkWithParallelBatch is the degenerate use of BenchmarkWithParallelOverhead
+// with the jobs batched by OptBatch before they are handed to the mappers
+func BenchmarkWithParallelBatch(b *testing.B) {
+	cores := 4
+	m, c := OptMappers(cores, func(i int) interface{} {
+		return rand.New(rand.NewSource(int64(i)))
+	}, nil)
+	defer c()
+
+	for n := 0; n < b.N; n++ {
+		add := reducers.NewAssociativeInt64(0, reducers.Add)
+		q, _ := Parallel(add.Value(), func(src interface{}, _ interface{}) interface{} {
+			localSrc := src.(*rand.Rand)
+			if heads := localSrc.Int() % 2; heads == 0 {
+				return int64(1)
+			}
+
+			return nil
+		}, add.Reducer(), add.Then(), m, OptBatch(1000, time.Millisecond), OptQueue(1000))
+
+		for v := 0; v < runs; v++ {
+			q <- 1
+		}
+		close(q)
+
+		count, err := add.Get()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		won := math.Round(100 * float64(count) / float64(runs))
+		if won != 50 {
+			b.Error("Unexpected result", won)
+		}
+	}
+}
+
+// BenchmarkWithParallelSubmitBatch is BenchmarkWithParallelBatch with the jobs handed
+// to the operation a batch at a time by SubmitBatch
+func BenchmarkWithParallelSubmitBatch(b *testing.B) {
+	cores := 4
+	m, c := OptMappers(cores, func(i int) interface{} {
+		return rand.New(rand.NewSource(int64(i)))
+	}, nil)
+	defer c()
+
+	jobs := make([]interface{}, 1000)
+	for i := range jobs {
+		jobs[i] = 1
+	}
+
+	for n := 0; n < b.N; n++ {
+		add := reducers.NewAssociativeInt64(0, reducers.Add)
+		op, _ := Start(add.Value(), func(src interface{}, _ interface{}) interface{} {
+			localSrc := src.(*rand.Rand)
+			if heads := localSrc.Int() % 2; heads == 0 {
+				return int64(1)
+			}
+
+			return nil
+		}, add.Reducer(), m, OptBatch(len(jobs), time.Millisecond), OptQueue(4*len(jobs)))
+
+		for v := 0; v < runs; v += len(jobs) {
+			if err := op.SubmitBatch(context.Background(), jobs); err != nil {
+				b.Fatal(err)
+			}
+		}
+		op.CloseInput()
+
+		count, err := add.Result(op.Wait(context.Background()))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		won := math.Round(100 * float64(count) / float64(runs))
+		if won != 50 {
+			b.Error("Unexpected result", won)
+		}
+	}
+}
+
 // BenchmarkWithParallel is an typical use case for small quick compute operations
 // as each mapper does a bundle of workunits
 func BenchmarkWithParallel(b *testing.B) {
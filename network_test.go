@@ -1,6 +1,7 @@
 package parallel
 
 import (
+	"context"
 	"testing"
 
 	"net/http"
@@ -109,13 +110,19 @@ func cipherSuite(state *tls.ConnectionState) string {
 }
 
 // perform the network request and return the TLS protocol
-func perform(client *http.Client, url string) string {
-	res, err := client.Get(url)
+func perform(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	return url + " = " + cipherSuite(res.TLS)
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	return url + " = " + cipherSuite(res.TLS), nil
 }
 
 // TestNetworkRequests checks top websites for their TLS cipher suites sequentially
@@ -124,7 +131,11 @@ func TestNetworkRequestsSerially(t *testing.T) {
 	all := make([]string, 0, len(testUrls))
 
 	for _, v := range testUrls {
-		all = append(all, perform(http.DefaultClient, "https://"+v))
+		res, err := perform(context.Background(), http.DefaultClient, "https://"+v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, res)
 	}
 
 	if l := len(all); len(testUrls) != l {
@@ -148,9 +159,9 @@ func TestNetworkRequestsInParallel(t *testing.T) {
 
 	list := reducers.NewStringList(len(testUrls))
 
-	q, err := Parallel(list.Value(), func(client interface{}, url interface{}) interface{} {
-		return perform(client.(*http.Client), url.(string))
-	}, list.Reducer(), list.Then(), m)
+	q, err := ParallelCtx(list.Value(), func(ctx context.Context, client interface{}, url interface{}) (interface{}, error) {
+		return perform(ctx, client.(*http.Client), url.(string))
+	}, list.Reducer(), list.Then(), m, OptJobTimeout(time.Second*10))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,371 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrOpClosed indicates a job was submitted after the input of the operation was closed
+	ErrOpClosed = errors.New("operation input is closed")
+
+	// ErrOpCancelled indicates a job was submitted after the operation ended early, the cause
+	// (e.g. context.Canceled or an ErrTrappedPanic) is wrapped in the returned error
+	ErrOpCancelled = errors.New("operation was cancelled")
+)
+
+// input is a job queue that is safe to submit to and close from multiple go routines
+type input[J any] struct {
+	in chan J
+	// ctx ends when the jobs are no longer consumed
+	ctx context.Context
+	// overflow is applied when in is full
+	overflow  OverflowPolicy
+	overflows overflows
+	// pq queues the jobs by priority in front of in, if set
+	pq *priorityQueue[J]
+	// batches takes the jobs of SubmitBatch alongside in, if set
+	batches chan []J
+	// steal takes the jobs in place of in with OptWorkStealing, if set
+	steal *stealer[J]
+
+	// mu is held for reading while submitting and for writing while closing in
+	mu      sync.RWMutex
+	closing chan struct{}
+	closed  bool
+	once    sync.Once
+}
+
+func newInput[J any](ctx context.Context, in chan J) input[J] {
+	return input[J]{in: in, ctx: ctx, closing: make(chan struct{})}
+}
+
+// OpOf is a handle on a running operation that is used to submit jobs and
+// to wait for or cancel the operation
+type OpOf[J, A any] struct {
+	input[J]
+
+	done   chan struct{}
+	value  A
+	err    error
+	cancel context.CancelCauseFunc
+}
+
+// Op is the handle returned by Start
+type Op = OpOf[interface{}, interface{}]
+
+// Start is the equivalent of Parallel that returns an Op handle in place of
+// the job queue and the `then` callback
+func Start(value interface{},
+	mapper func(init interface{}, job interface{}) interface{},
+	reducer func(previous interface{}, current interface{}) interface{},
+	opts ...Option) (*Op, error) {
+
+	return StartOf(value, mapper, reducer, opts...)
+}
+
+// StartErr is the equivalent of ParallelErr that returns an Op handle in place of
+// the job queue and the `then` callback
+func StartErr(value interface{},
+	mapper func(init interface{}, job interface{}) (interface{}, error),
+	reducer func(previous interface{}, current interface{}) interface{},
+	opts ...Option) (*Op, error) {
+
+	return StartErrOf(value, mapper, reducer, opts...)
+}
+
+// StartCtx is the equivalent of ParallelCtx that returns an Op handle in place of
+// the job queue and the `then` callback
+func StartCtx(value interface{},
+	mapper func(ctx context.Context, init interface{}, job interface{}) (interface{}, error),
+	reducer func(previous interface{}, current interface{}) interface{},
+	opts ...Option) (*Op, error) {
+
+	return StartCtxOf(value, mapper, reducer, opts...)
+}
+
+// StartOf is the typed equivalent of Start
+func StartOf[S, J, R, A any](value A,
+	mapper func(init S, job J) R,
+	reducer func(previous A, current R) A,
+	opts ...Option) (*OpOf[J, A], error) {
+
+	return StartErrOf(value, func(s S, j J) (R, error) {
+		return mapper(s, j), nil
+	}, reducer, opts...)
+}
+
+// StartErrOf is the typed equivalent of StartErr
+func StartErrOf[S, J, R, A any](value A,
+	mapper func(init S, job J) (R, error),
+	reducer func(previous A, current R) A,
+	opts ...Option) (*OpOf[J, A], error) {
+
+	return StartCtxOf(value, func(_ context.Context, s S, j J) (R, error) {
+		return mapper(s, j)
+	}, reducer, opts...)
+}
+
+// StartCtxOf is the typed equivalent of StartCtx
+func StartCtxOf[S, J, R, A any](value A,
+	mapper func(ctx context.Context, init S, job J) (R, error),
+	reducer func(previous A, current R) A,
+	opts ...Option) (*OpOf[J, A], error) {
+
+	o, err := makeOptionsOf[S, R](opts)
+	if err != nil {
+		return nil, err
+	}
+	o.owned = true
+
+	// the priority queue replaces the buffer of the job queue
+	var pq *priorityQueue[J]
+	if o.priority {
+		pq = newPriorityQueue[J](o.queue, o.aging)
+		o.queue = 0
+	}
+
+	// with OptBatch SubmitBatch hands over whole slices of jobs
+	var batches chan []J
+	if o.batch > 1 && pq == nil {
+		batches = make(chan []J, (o.queue+o.batch-1)/o.batch)
+		o.batches = batches
+	}
+
+	// with OptWorkStealing Submit writes to the deques of the mappers unless the jobs are fed
+	var steal *stealer[J]
+	if o.stealing && !o.fed() && pq == nil {
+		steal = newStealer[J](o.mapper.size(), o.queue)
+		o.stealer = steal
+	}
+
+	op := &OpOf[J, A]{done: make(chan struct{})}
+
+	in, ctx, cancel := parallelCtx(o, value, mapper, reducer, func(final A, err error) {
+		op.value, op.err = final, err
+		close(op.done)
+	})
+	op.input, op.cancel = newInput(ctx, in), cancel
+	op.overflow, op.pq, op.batches, op.steal = o.overflow, pq, batches, steal
+
+	if pq != nil {
+		go pq.pump(ctx.Done(), in)
+	}
+
+	return op, nil
+}
+
+// Submit queues a job for the mappers, blocking while the job queue is full unless another
+// OptOverflow policy is set. ErrOpClosed is returned if CloseInput has been called and an error
+// wrapping ErrOpCancelled if the operation was cancelled, failed or a mapper panicked. If ctx
+// ends first its error is returned
+func (q *input[J]) Submit(ctx context.Context, job J) error {
+	return q.submit(ctx, job, 0, q.overflow)
+}
+
+// SubmitPriority is the equivalent of Submit for operations started with OptPriority, jobs
+// with a higher priority are mapped first. Submit queues jobs with a priority of 0. ErrNoPriority
+// is returned, and the job is not queued, if the operation was started without OptPriority
+func (q *input[J]) SubmitPriority(ctx context.Context, job J, priority int) error {
+	if q.pq == nil {
+		return ErrNoPriority
+	}
+
+	return q.submit(ctx, job, priority, q.overflow)
+}
+
+// TrySubmit is the equivalent of Submit that never blocks, ErrQueueFull is returned if the
+// job queue is full and the OptOverflow policy is OverflowBlock
+func (q *input[J]) TrySubmit(job J) error {
+	p := q.overflow
+	if p == OverflowBlock {
+		p = OverflowReject
+	}
+
+	return q.submit(context.Background(), job, 0, p)
+}
+
+func (q *input[J]) submit(ctx context.Context, job J, priority int, p OverflowPolicy) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrOpClosed
+	}
+
+	if err := q.cancelled(); err != nil {
+		return err
+	}
+
+	if q.offer(job, priority) {
+		return nil
+	}
+
+	switch p {
+	case OverflowReject:
+		atomic.AddInt64(&q.overflows.rejected, 1)
+		return ErrQueueFull
+	case OverflowDropOldest:
+		return q.replace(job, priority)
+	}
+	atomic.AddInt64(&q.overflows.blocked, 1)
+
+	if q.pq != nil {
+		return q.wait(ctx, job, priority)
+	}
+
+	if q.steal != nil {
+		return q.push(ctx, job)
+	}
+
+	select {
+	case q.in <- job:
+		return nil
+	case <-q.closing:
+		return ErrOpClosed
+	case <-q.ctx.Done():
+		return q.cancelled()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SubmitBatch queues jobs for the mappers like Submit. With OptBatch the jobs are handed over
+// in a single channel operation instead of one per job and the OptOverflow policy applies to
+// them as a whole, up to OptQueue jobs are buffered in calls to SubmitBatch of the batch size.
+// Without it the jobs are submitted in turn and an error means the jobs before it were queued.
+// The jobs of SubmitBatch and Submit are not ordered with respect to each other, even with
+// OptOrdered
+func (q *input[J]) SubmitBatch(ctx context.Context, jobs []J) error {
+	if q.batches == nil {
+		for _, j := range jobs {
+			if err := q.Submit(ctx, j); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// the jobs are read after SubmitBatch returns
+	b := append([]J(nil), jobs...)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrOpClosed
+	}
+
+	if err := q.cancelled(); err != nil {
+		return err
+	}
+
+	if len(b) == 0 {
+		return nil
+	}
+
+	select {
+	case q.batches <- b:
+		return nil
+	default:
+	}
+
+	switch q.overflow {
+	case OverflowReject:
+		atomic.AddInt64(&q.overflows.rejected, int64(len(b)))
+		return ErrQueueFull
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.batches <- b:
+				return nil
+			default:
+			}
+
+			if err := q.cancelled(); err != nil {
+				return err
+			}
+
+			select {
+			case old := <-q.batches:
+				atomic.AddInt64(&q.overflows.dropped, int64(len(old)))
+			default:
+			}
+		}
+	}
+	atomic.AddInt64(&q.overflows.blocked, 1)
+
+	select {
+	case q.batches <- b:
+		return nil
+	case <-q.closing:
+		return ErrOpClosed
+	case <-q.ctx.Done():
+		return q.cancelled()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// cancelled returns an error wrapping ErrOpCancelled and the cause if the operation ended early
+func (q *input[J]) cancelled() error {
+	if q.ctx.Err() == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %w", ErrOpCancelled, context.Cause(q.ctx))
+}
+
+// CloseInput signals that all the jobs have been submitted, the operation completes once
+// they have been mapped and reduced. Calling CloseInput more than once has no effect
+func (q *input[J]) CloseInput() {
+	q.once.Do(func() {
+		// unblock any pending Submit so the lock can be taken
+		close(q.closing)
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		q.closed = true
+		if q.pq != nil {
+			q.pq.close()
+		} else {
+			close(q.in)
+		}
+
+		if q.steal != nil {
+			q.steal.close()
+		}
+
+		if q.batches != nil {
+			close(q.batches)
+		}
+	})
+}
+
+// Wait blocks until the operation completes and returns the final output of the
+// reducer and/or any errors during the operation. If ctx ends first, the operation
+// is left running and the error of ctx is returned
+func (op *OpOf[J, A]) Wait(ctx context.Context) (A, error) {
+	select {
+	case <-op.done:
+		return op.value, op.err
+	case <-ctx.Done():
+		var zero A
+		return zero, ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed when the operation completes
+func (op *OpOf[J, A]) Done() <-chan struct{} {
+	return op.done
+}
+
+// Cancel stops the operation, the mappers skip any remaining jobs and Wait
+// returns context.Canceled
+func (op *OpOf[J, A]) Cancel() {
+	op.cancel(nil)
+}
@@ -0,0 +1,277 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redsift/go-parallel/mappers"
+	"github.com/redsift/go-parallel/reducers"
+)
+
+func TestStart(t *testing.T) {
+	add := reducers.NewAssociativeInt64(0, reducers.Add)
+
+	op, err := Start(add.Value(), mappers.Noop, add.Reducer())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []int64{0, 1, 2, -1} {
+		if err := op.Submit(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	total, err := add.Result(op.Wait(context.Background()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 2 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestStartOfDone(t *testing.T) {
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []int{0, 1, 2, -1} {
+		if err := op.Submit(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	select {
+	case <-op.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	total, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 2 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestOpCancel(t *testing.T) {
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op.Cancel()
+
+	if err := op.Submit(context.Background(), 1); !errors.Is(err, ErrOpCancelled) || !errors.Is(err, context.Canceled) {
+		t.Error("unexpected error", err)
+	}
+
+	total, err := op.Wait(context.Background())
+	if err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+
+	if total != 0 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestOpWaitContext(t *testing.T) {
+	op, err := Start(0, mappers.Noop, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	if _, err := op.Wait(ctx); err != context.DeadlineExceeded {
+		t.Error("unexpected error", err)
+	}
+
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); err != nil {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestOpSubmitClosed(t *testing.T) {
+	op, err := Start(0, mappers.Noop, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op.CloseInput()
+	op.CloseInput()
+
+	if err := op.Submit(context.Background(), 1); err != ErrOpClosed {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestOpSubmitPanic(t *testing.T) {
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		panic("junk")
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var serr error
+	for i := 0; i < 1000 && serr == nil; i++ {
+		serr = op.Submit(context.Background(), i)
+	}
+
+	var pnk ErrTrappedPanic
+	if !errors.Is(serr, ErrOpCancelled) || !errors.As(serr, &pnk) || pnk.Panic != "junk" {
+		t.Error("unexpected error", serr)
+	}
+
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); !errors.As(err, &pnk) {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestOpSubmitBlocked(t *testing.T) {
+	block := make(chan struct{})
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		<-block
+		return j
+	}, nil, OptQueue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var serr error
+	for i := 0; serr == nil; i++ {
+		serr = op.Submit(ctx, i)
+	}
+
+	if serr != context.DeadlineExceeded {
+		t.Error("unexpected error", serr)
+	}
+
+	go op.CloseInput()
+
+	if err := op.Submit(context.Background(), 1); err != ErrOpClosed {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestOpSubmitBatch(t *testing.T) {
+	for _, c := range []struct {
+		opts    []Option
+		ordered bool
+	}{
+		{nil, false},
+		{[]Option{OptBatch(10, 0)}, false},
+		{[]Option{OptBatch(10, time.Millisecond), OptQueue(25)}, false},
+		{[]Option{OptBatch(7, 0), OptOrdered()}, true},
+	} {
+		op, err := StartOf([]int(nil), func(_ interface{}, j int) int {
+			return j
+		}, func(p []int, c int) []int {
+			return append(p, c)
+		}, c.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// batches of every size from 1 to 37 jobs
+		n := 0
+		for sz := 1; sz <= 37; sz++ {
+			jobs := make([]int, sz)
+			for i := range jobs {
+				jobs[i] = n
+				n++
+			}
+
+			if err := op.SubmitBatch(context.Background(), jobs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		op.CloseInput()
+
+		all, err := op.Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(all) != n {
+			t.Fatal("unexpected length", len(all), c.opts)
+		}
+
+		seen := make([]bool, n)
+		for i, v := range all {
+			if c.ordered && v != i {
+				t.Fatal("out of order", i, v)
+			}
+			seen[v] = true
+		}
+		for i, ok := range seen {
+			if !ok {
+				t.Fatal("job not mapped", i, c.opts)
+			}
+		}
+	}
+}
+
+func TestOpSubmitBatchReject(t *testing.T) {
+	gate := make(chan struct{})
+	op := startGated(t, gate, 2, OptBatch(2, 0), OptOverflow(OverflowReject))
+
+	// the batches are taken by the feeder until it blocks on the gated mapper
+	n := 0
+	var err error
+	for i := 0; i < 50 && err == nil; i++ {
+		if err = op.SubmitBatch(context.Background(), []int{n, n + 1}); err == nil {
+			n += 2
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err != ErrQueueFull {
+		t.Fatal("unexpected error", err)
+	}
+
+	if s := op.Overflows(); s.Rejected != 2 {
+		t.Error("unexpected stats", s)
+	}
+
+	close(gate)
+	op.CloseInput()
+
+	if err := op.SubmitBatch(context.Background(), []int{0}); err != ErrOpClosed {
+		t.Error("unexpected error", err)
+	}
+
+	all, err := op.Wait(context.Background())
+	if err != nil || len(all) != n {
+		t.Error("unexpected result", len(all), n, err)
+	}
+}
@@ -0,0 +1,113 @@
+package parallel
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var (
+	// ErrOptInvalidValueOverflow indicates the overflow policy supplied is unknown
+	ErrOptInvalidValueOverflow = errors.New("invalid option value: overflow")
+
+	// ErrQueueFull indicates a job was not submitted as the job queue was full
+	ErrQueueFull = errors.New("job queue is full")
+)
+
+// OverflowPolicy controls what happens to a job submitted to an Op while its job queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks Submit until there is room in the job queue
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject fails Submit with ErrQueueFull
+	OverflowReject
+	// OverflowDropOldest discards the job that has been queued the longest to make room
+	OverflowDropOldest
+)
+
+// OptOverflow sets the OverflowPolicy of the job queue of an Op, defaults to OverflowBlock.
+// The size of the queue is set by OptQueue. It has no effect on the job queue returned by
+// Parallel as the caller writes to it directly
+func OptOverflow(p OverflowPolicy) Option {
+	return func(o *options) error {
+		if p < OverflowBlock || p > OverflowDropOldest {
+			return ErrOptInvalidValueOverflow
+		}
+		o.overflow = p
+		return nil
+	}
+}
+
+// OverflowStats counts the jobs affected by a full job queue
+type OverflowStats struct {
+	// Blocked is the number of calls to Submit that waited for room in the queue
+	Blocked int64
+	// Rejected is the number of jobs that failed with ErrQueueFull
+	Rejected int64
+	// Dropped is the number of queued jobs discarded by OverflowDropOldest
+	Dropped int64
+}
+
+// overflows are the counters of an input, updated atomically
+type overflows struct {
+	blocked, rejected, dropped int64
+}
+
+// Overflows returns the number of jobs affected by a full job queue so far
+func (q *input[J]) Overflows() OverflowStats {
+	return OverflowStats{
+		Blocked:  atomic.LoadInt64(&q.overflows.blocked),
+		Rejected: atomic.LoadInt64(&q.overflows.rejected),
+		Dropped:  atomic.LoadInt64(&q.overflows.dropped),
+	}
+}
+
+// offer queues job without blocking, it reports false if the queue is full
+func (q *input[J]) offer(job J, priority int) bool {
+	if q.pq != nil {
+		ok, _ := q.pq.offer(job, priority)
+		return ok
+	}
+
+	if q.steal != nil {
+		return q.steal.offer(task[J]{job: job})
+	}
+
+	select {
+	case q.in <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// replace queues job, discarding the oldest queued jobs until there is room
+func (q *input[J]) replace(job J, priority int) error {
+	for !q.offer(job, priority) {
+		if err := q.cancelled(); err != nil {
+			return err
+		}
+
+		if q.pq != nil {
+			if q.pq.dropOldest() {
+				atomic.AddInt64(&q.overflows.dropped, 1)
+			}
+			continue
+		}
+
+		if q.steal != nil {
+			if q.steal.dropOldest() {
+				atomic.AddInt64(&q.overflows.dropped, 1)
+			}
+			continue
+		}
+
+		select {
+		case <-q.in:
+			atomic.AddInt64(&q.overflows.dropped, 1)
+		default:
+		}
+	}
+
+	return nil
+}
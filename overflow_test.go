@@ -0,0 +1,162 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// startGated starts an operation on a single mapper that blocks until gate is closed with
+// a job queue of size queue, the jobs are collected in the order they were mapped
+func startGated(t *testing.T, gate chan struct{}, queue int, opts ...Option) *OpOf[int, []int] {
+	t.Helper()
+
+	m, c := OptMappers(1, nil, nil)
+	t.Cleanup(c)
+
+	op, err := StartOf([]int(nil), func(_ interface{}, j int) int {
+		<-gate
+		return j
+	}, func(p []int, c int) []int {
+		return append(p, c)
+	}, append(opts, m, OptQueue(queue))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return op
+}
+
+// fill submits jobs until the queue stays full, it returns the number of jobs submitted
+func fill(t *testing.T, op *OpOf[int, []int]) int {
+	t.Helper()
+
+	n := 0
+	for {
+		accepted := false
+		for op.TrySubmit(n) == nil {
+			n++
+			accepted = true
+		}
+
+		if !accepted && n > 0 {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	gate := make(chan struct{})
+	op := startGated(t, gate, 2)
+
+	n := fill(t, op)
+
+	if err := op.TrySubmit(n); err != ErrQueueFull {
+		t.Error("unexpected error", err)
+	}
+
+	submitted := make(chan error)
+	go func() {
+		submitted <- op.Submit(context.Background(), n)
+	}()
+
+	eventually(t, func() bool { return op.Overflows().Blocked == 1 })
+	close(gate)
+
+	if err := <-submitted; err != nil {
+		t.Fatal(err)
+	}
+	op.CloseInput()
+
+	mapped, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mapped) != n+1 {
+		t.Error("unexpected jobs", len(mapped), n+1)
+	}
+
+	// TrySubmit rejects the jobs instead of blocking
+	if st := op.Overflows(); st.Rejected < 2 || st.Dropped != 0 {
+		t.Error("unexpected stats", st)
+	}
+}
+
+func TestOverflowReject(t *testing.T) {
+	gate := make(chan struct{})
+	op := startGated(t, gate, 2, OptOverflow(OverflowReject))
+
+	n := fill(t, op)
+
+	if err := op.Submit(context.Background(), n); err != ErrQueueFull {
+		t.Error("unexpected error", err)
+	}
+
+	close(gate)
+	op.CloseInput()
+
+	mapped, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mapped) != n {
+		t.Error("unexpected jobs", len(mapped), n)
+	}
+
+	if st := op.Overflows(); st.Blocked != 0 || st.Rejected < 2 {
+		t.Error("unexpected stats", st)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	gate := make(chan struct{})
+	op := startGated(t, gate, 2, OptOverflow(OverflowDropOldest))
+
+	for i := 0; i < 100; i++ {
+		if err := op.TrySubmit(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(gate)
+	op.CloseInput()
+
+	mapped, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := op.Overflows()
+	if st.Dropped == 0 || int64(len(mapped))+st.Dropped != 100 {
+		t.Error("unexpected stats", st, len(mapped))
+	}
+
+	// the newest jobs are kept
+	if mapped[len(mapped)-1] != 99 {
+		t.Error("newest job dropped")
+	}
+}
+
+func TestOverflowCancelled(t *testing.T) {
+	gate := make(chan struct{})
+	defer close(gate)
+
+	op := startGated(t, gate, 2, OptOverflow(OverflowDropOldest))
+	op.Cancel()
+
+	if err := op.TrySubmit(1); !errors.Is(err, ErrOpCancelled) {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestOverflowInvalid(t *testing.T) {
+	if _, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		return j
+	}, nil, OptOverflow(OverflowPolicy(-1))); err != ErrOptInvalidValueOverflow {
+		t.Error("unexpected error", err)
+	}
+}
@@ -7,8 +7,12 @@ import (
 	"fmt"
 	"runtime"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/redsift/go-parallel/reducers"
 )
 
 var (
@@ -18,27 +22,158 @@ var (
 	// ErrOptInvalidValueContext indicates the option supplied to set the context for the parallel operation is invalid
 	ErrOptInvalidValueContext = errors.New("invalid option value: context")
 
+	// ErrOptInvalidValueMappers indicates the mapper pool supplied creates `init` values of a different
+	// type to the one expected by the mapper function. The `init` values of untyped pools are only
+	// checked at run time, the operation then fails with an error that wraps it
+	ErrOptInvalidValueMappers = errors.New("invalid option value: mappers")
+
+	// ErrOptInvalidValueFailure indicates the failure policy supplied is unknown
+	ErrOptInvalidValueFailure = errors.New("invalid option value: failure")
+
+	// ErrOptInvalidValueWindow indicates the size of the reorder window is invalid
+	ErrOptInvalidValueWindow = errors.New("invalid option value: window")
+
+	// ErrOptInvalidValueBatch indicates the size or delay of the batches is invalid
+	ErrOptInvalidValueBatch = errors.New("invalid option value: batch")
+
+	// ErrOptInvalidValueCombiner indicates the combiner does not accept the outputs of the
+	// mapper, has an invalid flush interval or was used with OptOrdered
+	ErrOptInvalidValueCombiner = errors.New("invalid option value: combiner")
+
+	// ErrOptInvalidValueJobTimeout indicates the timeout for each job is invalid
+	ErrOptInvalidValueJobTimeout = errors.New("invalid option value: job timeout")
+
+	// ErrJobTimeout indicates a job was still being mapped when its timeout expired,
+	// it wraps context.DeadlineExceeded
+	ErrJobTimeout = errors.New("job timed out")
+
 	// ErrCancelledMapper indicates that the mapper option has been reused after being cancelled
 	ErrCancelledMapper = errors.New("mapper was already cancelled")
 )
 
+// Phase is the part of an operation in which a panic was trapped
+type Phase int
+
+const (
+	// PhaseMap is a panic in a mapper or a combiner
+	PhaseMap Phase = iota
+	// PhaseReduce is a panic in a reducer
+	PhaseReduce
+)
+
+func (p Phase) String() string {
+	if p == PhaseReduce {
+		return "reduce"
+	}
+	return "map"
+}
+
 // ErrTrappedPanic wraps an underlying panic and call stack for
 // a panic that was trapped during mapping or reduction
 type ErrTrappedPanic struct {
 	Panic interface{}
 	Stack []byte
+	Phase Phase
+	// Worker is the index of the mapper go routine, -1 in the reduce phase
+	Worker int
+	// Job is the job that was being mapped, nil in the reduce phase
+	Job interface{}
 }
 
 func (e ErrTrappedPanic) Error() string {
 	return fmt.Sprint(e.Panic, "\n", string(e.Stack))
 }
 
-type mapper struct {
-	count int
+// summary describes the panic on a single line
+func (e ErrTrappedPanic) summary() string {
+	if e.Phase == PhaseReduce {
+		return fmt.Sprintf("reduce: %v", e.Panic)
+	}
+	return fmt.Sprintf("map worker %d job %v: %v", e.Worker, e.Job, e.Panic)
+}
+
+// maxTrappedPanics is the number of panics kept for an operation
+const maxTrappedPanics = 32
+
+// ErrTrappedPanics collects every panic trapped during an operation, up to 32 of them. The
+// individual panics can be inspected with errors.As and ErrTrappedPanic
+type ErrTrappedPanics struct {
+	Panics []ErrTrappedPanic
+	// Dropped is the number of panics that were trapped once the limit was reached
+	Dropped int
+}
+
+func (e ErrTrappedPanics) Error() string {
+	msgs := make([]string, 0, len(e.Panics))
+	for _, p := range e.Panics {
+		msgs = append(msgs, p.summary())
+	}
+
+	msg := fmt.Sprintf("%d trapped panics: %s", len(e.Panics)+e.Dropped, strings.Join(msgs, "; "))
+	if e.Dropped > 0 {
+		msg += fmt.Sprintf(" (%d more dropped)", e.Dropped)
+	}
+
+	return msg
+}
+
+// Unwrap returns the collected panics
+func (e ErrTrappedPanics) Unwrap() []error {
+	errs := make([]error, 0, len(e.Panics))
+	for _, p := range e.Panics {
+		errs = append(errs, p)
+	}
+
+	return errs
+}
+
+// panics collects the panics trapped during an operation
+type panics struct {
+	mu  sync.Mutex
+	err ErrTrappedPanics
+}
+
+func (p *panics) trap(e ErrTrappedPanic) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.err.Panics) == maxTrappedPanics {
+		p.err.Dropped++
+		return
+	}
+	p.err.Panics = append(p.err.Panics, e)
+}
+
+// get returns the collected panics or nil if there were none
+func (p *panics) get() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	parallel chan mapperOp
+	if len(p.err.Panics) == 0 {
+		return nil
+	}
 
-	trapped atomic.Value
+	return ErrTrappedPanics{append([]ErrTrappedPanic(nil), p.err.Panics...), p.err.Dropped}
+}
+
+// ErrMulti collects the errors returned by mappers under the CollectAll policy,
+// the individual errors can be inspected with errors.Is and errors.As
+type ErrMulti struct {
+	Errs []error
+}
+
+func (e ErrMulti) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("%d mapper errors: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the collected errors
+func (e ErrMulti) Unwrap() []error {
+	return e.Errs
 }
 
 type options struct {
@@ -46,7 +181,40 @@ type options struct {
 	ctx    context.Context
 	mapper *mapper
 	// cancel function for mapper, set if default mapper is used
-	cancel CancelFunc
+	cancel  CancelFunc
+	failure FailurePolicy
+	ordered bool
+	window  int
+	batch   int
+	delay   time.Duration
+	// combiner is a func(R, R) R for mappers with outputs of type R
+	combiner   interface{}
+	flush      time.Duration
+	partitions int
+	limiter    *Limiter
+	// rateLimiter throttles the tasks sent to the mappers
+	rateLimiter *RateLimiter
+	// deadLetter or deadLetters receive the jobs that failed
+	deadLetter  func(DeadLetter)
+	deadLetters chan<- DeadLetter
+	retry       *RetryPolicy
+	jobTimeout  time.Duration
+	overflow    OverflowPolicy
+	// tenant, weight and max describe the operation to a shared pool
+	tenant string
+	weight int
+	max    int
+	// priority queues the jobs of an Op by priority, with aging
+	priority bool
+	aging    time.Duration
+	// owned is set if the job queue is written by an Op
+	owned bool
+	// batches is a chan []J that SubmitBatch writes to in place of the job queue
+	batches interface{}
+	// stealing gives each mapper go routine its own job queue, stealer is a *stealer[J]
+	// that Submit writes to in place of the job queue
+	stealing bool
+	stealer  interface{}
 }
 
 // Option encapsulate all available options for the Parallel operation
@@ -76,99 +244,219 @@ func OptContext(ctx context.Context) Option {
 	}
 }
 
-type mapperOp struct {
-	fn       func(interface{}, interface{}) interface{}
-	in, out  chan interface{}
-	wg       *sync.WaitGroup
-	cls, clx <-chan struct{}
+// OptJobTimeout ends the context passed to the mappers of ParallelCtx once a job has been
+// mapped for longer than d, the job then fails with ErrJobTimeout. A go routine that ignores
+// the end of the context for another d is reported by Pool.Stuck, on pools created with NewPool
+func OptJobTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return ErrOptInvalidValueJobTimeout
+		}
+		o.jobTimeout = d
+		return nil
+	}
 }
 
-// CancelFunc tells a mapper to shut down any worker routines
-type CancelFunc func()
+// FailurePolicy controls how an operation reacts to errors returned by its mappers
+type FailurePolicy int
 
-// OptMappers can be used to control the number of go routines used to run mappers
-// (defaults to runtime.NumCPU()) and supply `init` and `destroy` hooks for the routines
-func OptMappers(sz int, init func(int) interface{}, destroy func(interface{})) (Option, CancelFunc) {
-	if sz < 1 {
-		sz = runtime.NumCPU() // cant change after process is started
+const (
+	// FailFast cancels the operation and passes the first error to `then`
+	FailFast FailurePolicy = iota
+	// CollectAll maps every job and passes all the errors to `then` as an ErrMulti
+	CollectAll
+	// SkipAndContinue drops the jobs that failed and reduces the rest
+	SkipAndContinue
+)
+
+// OptFailure sets the FailurePolicy for mappers that return errors, defaults to FailFast
+func OptFailure(p FailurePolicy) Option {
+	return func(o *options) error {
+		if p < FailFast || p > SkipAndContinue {
+			return ErrOptInvalidValueFailure
+		}
+		o.failure = p
+		return nil
 	}
-	m, c := newMapper(sz, init, destroy)
+}
 
+// OptOrdered makes the reducer receive the outputs of the mappers in the order the jobs
+// were submitted, mappers still run concurrently and their outputs are buffered until
+// the preceding outputs have been reduced
+func OptOrdered() Option {
 	return func(o *options) error {
-		o.mapper = m
+		o.ordered = true
+		return nil
+	}
+}
 
+// OptReorderWindow limits how many jobs (or batches with OptBatch) may be mapped ahead of the
+// oldest job that is yet to be reduced when using OptOrdered, defaults to twice the number of
+// mapper go routines
+func OptReorderWindow(sz int) Option {
+	return func(o *options) error {
+		if sz < 1 {
+			return ErrOptInvalidValueWindow
+		}
+		o.window = sz
 		return nil
-	}, c
+	}
 }
 
-func newMapper(sz int, init func(int) interface{}, destroy func(interface{})) (*mapper, CancelFunc) {
-	m := &mapper{count: sz, parallel: make(chan mapperOp, sz)}
+// OptBatch groups up to sz jobs into a batch that is mapped by a single go routine, reducing the
+// channel operations per job. A partial batch is dispatched once maxDelay has passed since its
+// first job was submitted, or only when the job queue is closed if maxDelay is 0
+func OptBatch(sz int, maxDelay time.Duration) Option {
+	return func(o *options) error {
+		if sz < 1 || maxDelay < 0 {
+			return ErrOptInvalidValueBatch
+		}
+		o.batch = sz
+		o.delay = maxDelay
+		return nil
+	}
+}
 
-	for i := 0; i < m.count; i++ {
-		var s interface{}
-		if init != nil {
-			s = init(i)
+// OptCombiner folds the outputs of each mapper go routine locally using fn before they are
+// passed to the reducer, this reduces the load on the reducer for associative reductions.
+// fn must be associative and commutative and combine two outputs of the mapper into a value
+// that the reducer would treat as equivalent to reducing both outputs in turn. The local
+// fold of each go routine is passed to the reducer when the job queue is closed or, if flush
+// is not 0, once flush has passed since its first output, even if no more jobs arrive.
+// OptCombiner can not be used with OptOrdered
+func OptCombiner(fn func(a, b interface{}) interface{}, flush time.Duration) Option {
+	return optCombiner(fn, flush)
+}
+
+// OptCombinerOf is the typed equivalent of OptCombiner for mappers with outputs of type R
+func OptCombinerOf[R any](fn func(a, b R) R, flush time.Duration) Option {
+	return optCombiner(fn, flush)
+}
+
+func optCombiner(fn interface{}, flush time.Duration) Option {
+	return func(o *options) error {
+		if flush < 0 {
+			return ErrOptInvalidValueCombiner
 		}
+		o.combiner = fn
+		o.flush = flush
+		return nil
+	}
+}
 
-		// call_map
-		go func(i int, s interface{}) {
-			var in chan interface{}
-			var wg *sync.WaitGroup
-			defer func() {
-				if r := recover(); r != nil {
-					err := ErrTrappedPanic{r, debug.Stack()}
-					m.trapped.Store(err)
-				}
+// combinerOf returns the combiner for outputs of type R if one was supplied,
+// untyped combiners are adapted with a cast
+func combinerOf[R any](c interface{}) (func(a, b R) R, bool) {
+	switch fn := c.(type) {
+	case nil:
+		return nil, true
+	case func(a, b R) R:
+		return fn, fn != nil
+	case func(a, b interface{}) interface{}:
+		if fn == nil {
+			return nil, false
+		}
+		return func(a, b R) R {
+			return fn(a, b).(R)
+		}, true
+	}
 
-				if wg != nil {
-					wg.Done()
-				}
+	return nil, false
+}
 
-				// drain the in channel as we don't want the writer to
-				// block
-				if in != nil {
-					for range in {
-					}
-				}
+// task is a job, or a batch of jobs if batch is not nil, tagged with the sequence
+// in which it was submitted
+type task[J any] struct {
+	seq   uint64
+	job   J
+	batch []J
 
-				if destroy != nil {
-					destroy(s)
-				}
-			}()
+	// attempts is the number of times the job has been mapped under OptRetry
+	// and first is when the first attempt started
+	attempts int
+	first    time.Time
+}
 
-			for op := range m.parallel {
+// result is the output of the mapper for the task of the same sequence, ok is
+// false if the mapper failed. The outputs of the successful jobs of a batch are
+// held in batch
+type result[R any] struct {
+	seq   uint64
+	v     R
+	ok    bool
+	batch []R
+}
 
-				wg = op.wg
-				in = op.in
-			loop:
-				for {
-					select {
-					case <-op.clx:
-						break loop
-					case <-op.cls:
-						for _ = range in {
-						}
-						break loop
+// reorder passes the results to reduce in sequence, a slot of the window is released
+// for every result reduced
+func reorder[R any](out <-chan result[R], window chan struct{}, reduce func(result[R])) {
+	// results that arrived ahead of the next in sequence, indexed by their sequence modulo
+	// the size of the window as no more results than its size are mapped ahead of the next
+	sz := uint64(cap(window))
+	ahead := make([]result[R], sz)
+	arrived := make([]bool, sz)
 
-					case j, ok := <-in:
-						if !ok {
-							break loop
-						}
-						op.out <- op.fn(s, j)
-					}
-				}
+	var next uint64
+	for a := range out {
+		ahead[a.seq%sz], arrived[a.seq%sz] = a, true
 
-				wg.Done()
-				wg = nil
-				in = nil
-			}
-		}(i, s)
+		for i := next % sz; arrived[i]; i = next % sz {
+			a := ahead[i]
+			ahead[i], arrived[i] = result[R]{}, false
+			next++
+
+			reduce(a)
+			<-window
+		}
+	}
+}
+
+// CancelFunc tells a mapper to shut down any worker routines
+type CancelFunc func()
+
+// OptMappers can be used to control the number of go routines used to run mappers
+// (defaults to runtime.NumCPU()) and supply `init` and `destroy` hooks for the routines
+func OptMappers(sz int, init func(int) interface{}, destroy func(interface{})) (Option, CancelFunc) {
+	p := NewPool(sz, init, destroy)
+	return p.Option(), p.Cancel
+}
+
+// OptMappersOf is the typed equivalent of OptMappers, the `init` values are passed
+// to the mappers of ParallelOf without a cast
+func OptMappersOf[S any](sz int, init func(int) S, destroy func(S)) (Option, CancelFunc) {
+	p := NewPoolOf(sz, init, destroy)
+	return p.Option(), p.Cancel
+}
+
+// stateOf casts an `init` value to the type expected by the mapper, go routines
+// without an `init` hook supply the zero value
+func stateOf[S any](s interface{}) S {
+	if s == nil {
+		var zero S
+		return zero
+	}
+
+	return s.(S)
+}
+
+// fits reports if the `init` values of the mapper can be supplied to mappers expecting S,
+// the `init` values of untyped pools are checked by the go routines as they join
+func fits[S any](m *mapper) bool {
+	if m.kind == nil {
+		return true
 	}
 
-	return m, func() {
-		m.trapped.Store(ErrTrappedPanic{Panic: ErrCancelledMapper})
-		close(m.parallel)
+	if _, ok := m.kind.(*S); ok {
+		return true
 	}
+
+	if _, ok := m.kind.(*interface{}); ok {
+		return true
+	}
+
+	// untyped mappers accept any `init` value
+	_, ok := interface{}((*S)(nil)).(*interface{})
+	return ok
 }
 
 func makeOptions(opts []Option) (*options, error) {
@@ -185,19 +473,59 @@ func makeOptions(opts []Option) (*options, error) {
 
 	// no mapper supplied, make a new one on every invocation
 	if o.mapper == nil {
-		m, c := newMapper(runtime.NumCPU(), nil, nil)
+		sz := runtime.NumCPU()
+		if o.limiter != nil {
+			sz = o.limiter.max
+		}
+		m, c := newMapper(sz, nil, nil)
 
 		o.mapper = m
 		o.cancel = c
 	}
 
 	if o.queue == 0 {
-		o.queue = o.mapper.count
+		o.queue = o.mapper.size()
+	}
+
+	if o.window == 0 {
+		o.window = 2 * o.mapper.size()
 	}
 
 	return &o, nil
 }
 
+// fed reports if an option needs the jobs to be fed to the mappers by a go routine
+func (o *options) fed() bool {
+	return o.ordered || o.batch > 1 || o.retry != nil || o.rateLimiter != nil
+}
+
+// makeOptionsOf is makeOptions for mappers that expect `init` values of type S
+// and output values of type R
+func makeOptionsOf[S, R any](opts []Option) (*options, error) {
+	o, err := makeOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nil
+	if !fits[S](o.mapper) {
+		err = ErrOptInvalidValueMappers
+	} else if _, ok := combinerOf[R](o.combiner); !ok || (o.combiner != nil && o.ordered) {
+		err = ErrOptInvalidValueCombiner
+	} else if o.retry != nil && o.ordered && o.batch > 1 {
+		err = ErrOptInvalidValueRetry
+	}
+
+	if err != nil {
+		if o.cancel != nil {
+			o.cancel()
+		}
+		return nil, err
+	}
+
+	return o, nil
+}
+
 // Parallel performs a map/reduce using go routines and channels
 //
 // value: is the initial value of the reducer i.e. the first `previous` for the reducer
@@ -213,18 +541,262 @@ func Parallel(value interface{},
 	then func(final interface{}, err error),
 	opts ...Option) (chan interface{}, error) {
 
-	o, err := makeOptions(opts)
+	return ParallelOf(value, mapper, reducer, then, opts...)
+}
+
+// ParallelErr is the equivalent of Parallel for mappers that can fail, how the operation
+// reacts to the errors returned by the mapper is controlled by OptFailure
+func ParallelErr(value interface{},
+	mapper func(init interface{}, job interface{}) (interface{}, error),
+	reducer func(previous interface{}, current interface{}) interface{},
+	then func(final interface{}, err error),
+	opts ...Option) (chan interface{}, error) {
+
+	return ParallelErrOf(value, mapper, reducer, then, opts...)
+}
+
+// ParallelOf is the typed equivalent of Parallel
+//
+// S: is the type of the `init` values supplied by OptMappersOf
+// J: is the type of the jobs submitted to the returned channel
+// R: is the type of the output of the mapper i.e. `current` for the reducer
+// A: is the type of the accumulator i.e. `previous` for the reducer and `final` for then
+//
+// ErrOptInvalidValueMappers is returned if the mapper pool supplies `init` values that are not of
+// type S. Pools created with NewPool or OptMappers are untyped, S is then checked at run time and
+// the operation fails with an error that wraps ErrOptInvalidValueMappers
+func ParallelOf[S, J, R, A any](value A,
+	mapper func(init S, job J) R,
+	reducer func(previous A, current R) A,
+	then func(final A, err error),
+	opts ...Option) (chan J, error) {
+
+	return ParallelErrOf(value, func(s S, j J) (R, error) {
+		return mapper(s, j), nil
+	}, reducer, then, opts...)
+}
+
+// ParallelErrOf is the typed equivalent of ParallelErr
+func ParallelErrOf[S, J, R, A any](value A,
+	mapper func(init S, job J) (R, error),
+	reducer func(previous A, current R) A,
+	then func(final A, err error),
+	opts ...Option) (chan J, error) {
+
+	o, err := makeOptionsOf[S, R](opts)
 	if err != nil {
 		return nil, err
 	}
 
-	in := make(chan interface{}, o.queue)
-	out := make(chan interface{}, o.mapper.count)
+	in, _, _ := parallel(o, value, mapper, reducer, then)
+	return in, nil
+}
+
+// ParallelCtx is the equivalent of ParallelErr for mappers that take a context, it ends
+// when the operation is cancelled or fails, or when the job times out with OptJobTimeout
+func ParallelCtx(value interface{},
+	mapper func(ctx context.Context, init interface{}, job interface{}) (interface{}, error),
+	reducer func(previous interface{}, current interface{}) interface{},
+	then func(final interface{}, err error),
+	opts ...Option) (chan interface{}, error) {
+
+	return ParallelCtxOf(value, mapper, reducer, then, opts...)
+}
+
+// ParallelCtxOf is the typed equivalent of ParallelCtx
+func ParallelCtxOf[S, J, R, A any](value A,
+	mapper func(ctx context.Context, init S, job J) (R, error),
+	reducer func(previous A, current R) A,
+	then func(final A, err error),
+	opts ...Option) (chan J, error) {
+
+	o, err := makeOptionsOf[S, R](opts)
+	if err != nil {
+		return nil, err
+	}
+
+	in, _, _ := parallelCtx(o, value, mapper, reducer, then)
+	return in, nil
+}
+
+// parallel starts the map/reduce operation described by o, the returned context
+// ends with the operation and the function cancels it
+func parallel[S, J, R, A any](o *options, value A,
+	mapper func(init S, job J) (R, error),
+	reducer func(previous A, current R) A,
+	then func(final A, err error)) (chan J, context.Context, context.CancelCauseFunc) {
+
+	return parallelCtx(o, value, func(_ context.Context, s S, j J) (R, error) {
+		return mapper(s, j)
+	}, reducer, then)
+}
+
+// parallelCtx is parallel for mappers that take the context of the job
+func parallelCtx[S, J, R, A any](o *options, value A,
+	mapper func(ctx context.Context, init S, job J) (R, error),
+	reducer func(previous A, current R) A,
+	then func(final A, err error)) (chan J, context.Context, context.CancelCauseFunc) {
+
+	in := make(chan J, o.queue)
+	out := make(chan result[R], o.mapper.size())
+	batches, _ := o.batches.(chan []J)
+
+	// direct is set when no option needs the jobs to be fed to the mappers, they then
+	// take them from the job queue instead of jobs
+	direct := !o.fed() && !o.stealing
+
+	// steal replaces jobs with a deque per go routine, Submit writes to it when the jobs
+	// are not fed so the go routines do not contend on a channel
+	steal, _ := o.stealer.(*stealer[J])
+	if o.stealing && steal == nil {
+		steal = newStealer[J](o.mapper.size(), o.queue)
+	}
+
+	// feed is set when the jobs are handed to the mappers by call_feed
+	feed := !direct && o.stealer == nil
+	var jobs chan task[J]
+	if feed && steal == nil {
+		jobs = make(chan task[J], o.mapper.size())
+	}
+
+	var zero R
+	combiner, _ := combinerOf[R](o.combiner)
+
+	// the reducers of the helpers for associative operations double as combiners, they
+	// are recognised by their code as a func can not be marked, see reducers.Associative
+	if combiner == nil && !o.ordered {
+		if r, ok := interface{}(reducer).(func(interface{}, interface{}) interface{}); ok && reducers.Associative(r) {
+			combiner, _ = combinerOf[R](r)
+		}
+	}
+
+	var trapped panics
+
+	// ctx is cancelled early by the FailFast policy, panics and the caller
+	ctx, cancel := context.WithCancelCause(o.ctx)
+	done := ctx.Done()
+
+	if o.limiter != nil {
+		go o.limiter.wake(ctx)
+	}
+
+	var errs []error
+	var errsMu sync.Mutex
+	fail := func(err error) {
+		if o.failure == SkipAndContinue {
+			return
+		}
+
+		errsMu.Lock()
+		defer errsMu.Unlock()
+
+		if o.failure == FailFast {
+			if len(errs) == 0 {
+				errs = append(errs, err)
+			}
+			cancel(err)
+			return
+		}
+
+		errs = append(errs, err)
+	}
+
+	// letter passes a job that failed to the dead letter sink, if there is one
+	var letter func(d DeadLetter)
+	if o.deadLetter != nil {
+		letter = o.deadLetter
+	} else if o.deadLetters != nil {
+		letter = func(d DeadLetter) {
+			select {
+			case o.deadLetters <- d:
+			case <-done:
+			}
+		}
+	}
+
+	// failed reports the error of the last attempt of the mapper for a job
+	failed := func(t task[J], err error) {
+		if letter != nil {
+			letter(DeadLetter{Job: t.job, Err: err, Attempts: t.attempts, First: t.first, Last: time.Now()})
+			return
+		}
+
+		if o.retry == nil {
+			fail(err)
+			return
+		}
+
+		// panics trapped for retries still end the operation
+		var pnk ErrTrappedPanic
+		if errors.As(err, &pnk) {
+			trapped.trap(pnk)
+			cancel(pnk)
+			return
+		}
+
+		fail(ErrAttempts{err, t.attempts})
+	}
+
+	// outstanding counts the tasks that are dispatched or waiting to be retried, the
+	// job queue is only closed once it drops to 0 and idle is signalled when it does
+	var outstanding int64
+	var idle chan struct{}
+	var retries chan task[J]
+	if o.retry != nil {
+		idle = make(chan struct{}, 1)
+		retries = make(chan task[J])
+	}
+
+	// settle marks a task that is not retried as done
+	settle := func() {
+		if o.retry != nil && atomic.AddInt64(&outstanding, -1) == 0 {
+			select {
+			case idle <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	// retry re-queues a task that failed once its backoff expires, reporting
+	// if it will be retried. The task is outstanding until it is settled
+	retry := func(t task[J], err error) bool {
+		if o.retry == nil || !o.retry.retryable(t.attempts, err) {
+			return false
+		}
+
+		select {
+		case <-done:
+			return false
+		default:
+		}
 
-	var trapped atomic.Value
+		atomic.AddInt64(&outstanding, 1)
+		time.AfterFunc(o.retry.backoff(t.attempts), func() {
+			select {
+			case retries <- t:
+			case <-done:
+			}
+		})
 
-	var wg sync.WaitGroup
-	wg.Add(o.mapper.count)
+		return true
+	}
+
+	// report passes the outcome of a job to the Done hook of the retry policy
+	report := func(t task[J], err error) {
+		if o.retry != nil && o.retry.Done != nil {
+			o.retry.Done(t.job, t.attempts, err)
+		}
+	}
+
+	// window bounds the number of results that may be buffered ahead of
+	// the next result in sequence
+	var window chan struct{}
+	if o.ordered {
+		window = make(chan struct{}, o.window)
+	}
+
+	// mapped is closed once every job has been mapped
+	mapped := make(chan struct{})
 
 	var wo sync.WaitGroup
 	wo.Add(1)
@@ -234,65 +806,604 @@ func Parallel(value interface{},
 	// call_then
 	go func() {
 		defer func() {
+			cancel(nil)
 			if o.cancel != nil {
 				o.cancel()
 			}
 		}()
-		wg.Wait()
+		<-mapped
 		close(out)
 
 		if then != nil {
 			wo.Wait()
 
-			terr := trapped.Load()
-
-			if err := o.mapper.trapped.Load(); err != nil {
-				then(nil, err.(ErrTrappedPanic))
-			} else if terr != nil {
-				then(nil, terr.(ErrTrappedPanic))
-			} else if err := o.ctx.Err(); err != nil {
-				then(nil, err)
+			var zero A
+			if err := trapped.get(); err != nil {
+				then(zero, err)
+			} else if err := o.mapper.trapped.Load(); err != nil && err.(ErrTrappedPanic).Panic != ErrCancelledMapper {
+				// the operations started before the pool was shut down are not affected
+				then(zero, ErrTrappedPanics{Panics: []ErrTrappedPanic{err.(ErrTrappedPanic)}})
+			} else if o.failure == FailFast && len(errs) > 0 {
+				then(zero, errs[0])
+			} else if err := context.Cause(ctx); err != nil {
+				then(zero, err)
+			} else if len(errs) > 0 {
+				then(t, ErrMulti{errs})
 			} else {
 				then(t, err)
 			}
 		}
 	}()
 
-	cls := o.ctx.Done()
-	clx := make(chan struct{})
-	if reducer != nil {
+	// call_reduce
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err := ErrTrappedPanic{Panic: r, Stack: debug.Stack(), Phase: PhaseReduce, Worker: -1}
+
+				trapped.trap(err)
+
+				// at this point the map operations might be stuck
+				// writing so signal them to close
+				cancel(err)
+			}
+			wo.Done()
+
+			// drain the out channel to unblock the map operations
+			for range out {
+			}
+		}()
+
+		reduce := func(a result[R]) {
+			if reducer == nil {
+				return
+			}
+
+			if a.batch != nil {
+				for _, v := range a.batch {
+					t = reducer(t, v)
+				}
+				return
+			}
+
+			if a.ok {
+				t = reducer(t, a.v)
+			}
+		}
+
+		if !o.ordered {
+			for a := range out {
+				reduce(a)
+			}
+			return
+		}
+
+		reorder(out, window, reduce)
+	}()
+
+	if err := o.mapper.trapped.Load(); err != nil {
+		panic(err) // can't reuse after panic, see OptSelfHealing
+	}
+
+	// drain discards the jobs written to a cancelled job queue until the caller closes it,
+	// in the background so the mapper go routines are free to leave the operation
+	var draining sync.Once
+	drain := func() {
+		// an Op never writes to a cancelled job queue
+		if o.owned {
+			return
+		}
 
-		// call_reduce
+		draining.Do(func() {
+			go func() {
+				for range in {
+				}
+			}()
+		})
+	}
+
+	// call_feed
+	if feed {
 		go func() {
 			defer func() {
-				if r := recover(); r != nil {
-					err := ErrTrappedPanic{r, debug.Stack()}
+				if steal != nil {
+					steal.close()
+				} else {
+					close(jobs)
+				}
+			}()
 
-					trapped.Store(err)
+			// throttle waits for the rate limiter to allow every job of t
+			throttle := func(t task[J]) bool {
+				if o.rateLimiter == nil {
+					return true
 				}
-				wo.Done()
 
-				// at this point the map operations might be stuck
-				// writing so signal them to close using clx and drain
-				// the out channel to unblock them
-				close(clx)
-				for range out {
+				n := 1
+				if t.batch != nil {
+					n = len(t.batch)
+				}
+
+				return o.rateLimiter.wait(done, n)
+			}
+
+			// send hands a task to the mappers
+			send := func(t task[J]) bool {
+				if steal != nil {
+					return steal.send(t, done)
+				}
+
+				select {
+				case jobs <- t:
+					return true
+				case <-done:
+					return false
+				}
+			}
+
+			// redispatch sends a task that is retried, it keeps its sequence and place
+			// in the reorder window
+			redispatch := func(t task[J]) bool {
+				return throttle(t) && send(t)
+			}
+
+			var seq uint64
+			dispatch := func(t task[J]) bool {
+				t.seq = seq
+
+				// retries are accepted while waiting as they may be holding up the window
+				for wait := window != nil; wait; {
+					select {
+					case window <- struct{}{}:
+						wait = false
+					case r := <-retries:
+						if !redispatch(r) {
+							return false
+						}
+					case <-done:
+						return false
+					}
+				}
+
+				if !throttle(t) {
+					return false
+				}
+
+				if o.retry != nil {
+					atomic.AddInt64(&outstanding, 1)
+				}
+
+				if !send(t) {
+					return false
+				}
+				seq++
+
+				return true
+			}
+
+			// batch collects jobs until it is full or the delay expires
+			var batch []J
+			var delay *time.Timer
+			var flush <-chan time.Time
+			dispatchBatch := func() bool {
+				if delay != nil {
+					delay.Stop()
+					delay, flush = nil, nil
+				}
+
+				b := batch
+				batch = nil
+
+				return dispatch(task[J]{batch: b})
+			}
+
+			// collect adds j to the batch and dispatches it once it is full
+			collect := func(j J) bool {
+				if batch == nil {
+					batch = make([]J, 0, o.batch)
+					if o.delay > 0 {
+						delay = time.NewTimer(o.delay)
+						flush = delay.C
+					}
+				}
+
+				batch = append(batch, j)
+				return len(batch) < o.batch || dispatchBatch()
+			}
+
+			// finish dispatches the last batch once the job queue is closed, then waits
+			// for the retries of the jobs that are still outstanding
+			finish := func() {
+				if len(batch) > 0 && !dispatchBatch() {
+					return
+				}
+
+				for o.retry != nil && atomic.LoadInt64(&outstanding) > 0 {
+					select {
+					case r := <-retries:
+						if !redispatch(r) {
+							return
+						}
+					case <-idle:
+					case <-done:
+						return
+					}
+				}
+			}
+
+			// the jobs of SubmitBatch arrive on bq, the queue is closed once both are
+			jq, bq := in, batches
+			for {
+				select {
+				case <-done:
+					drain()
+					return
+
+				case <-flush:
+					if !dispatchBatch() {
+						drain()
+						return
+					}
+
+				case r := <-retries:
+					if !redispatch(r) {
+						drain()
+						return
+					}
+
+				case j, ok := <-jq:
+					if !ok {
+						jq = nil
+						if bq == nil {
+							finish()
+							return
+						}
+						continue
+					}
+
+					if o.batch < 2 {
+						if !dispatch(task[J]{job: j}) {
+							drain()
+							return
+						}
+						continue
+					}
+
+					if !collect(j) {
+						drain()
+						return
+					}
+
+				case b, ok := <-bq:
+					if !ok {
+						bq = nil
+						if jq == nil {
+							finish()
+							return
+						}
+						continue
+					}
+
+					// SubmitBatch hands over a copy of the jobs, so full batches are
+					// dispatched without copying them again
+					for len(batch) == 0 && len(b) >= o.batch {
+						if !dispatch(task[J]{batch: b[:o.batch:o.batch]}) {
+							drain()
+							return
+						}
+						b = b[o.batch:]
+					}
+
+					for _, j := range b {
+						if !collect(j) {
+							drain()
+							return
+						}
+					}
 				}
-			}()
-			for a := range out {
-				t = reducer(t, a)
 			}
 		}()
 	}
 
-	if err := o.mapper.trapped.Load(); err != nil {
-		panic(err) // can't reuse after panic TODO: Docs
-	}
+	m := &mapperOp{
+		run: func(s interface{}, w *worker) (finished bool, err error) {
+			worker, quit, wake := w.index, w.quit, w.wake
+
+			// the `init` values of untyped pools may not be of type S, the jobs taken
+			// once the operation is cancelled are skipped
+			st, ok := s.(S)
+			if !ok && s != nil {
+				cancel(fmt.Errorf("%w: `init` value of type %T", ErrOptInvalidValueMappers, s))
+			}
+
+			// cur is the job being mapped when a panic is trapped
+			var cur J
+			defer func() {
+				if r := recover(); r != nil {
+					err = ErrTrappedPanic{Panic: r, Stack: debug.Stack(), Phase: PhaseMap, Worker: worker, Job: cur}
+				}
+			}()
+
+			// timed is set if the time of the first attempt of a job is reported
+			timed := letter != nil || o.retry != nil
+
+			// call maps a job, with a dead letter sink panics are trapped for
+			// each job so the go routine carries on with the next one
+			call := mapper
+			if letter != nil || o.retry != nil {
+				call = func(ctx context.Context, s S, j J) (r R, err error) {
+					defer func() {
+						if rec := recover(); rec != nil {
+							err = ErrTrappedPanic{Panic: rec, Stack: debug.Stack(), Phase: PhaseMap, Worker: worker, Job: j}
+						}
+					}()
+
+					return mapper(ctx, s, j)
+				}
+			}
+
+			// invoke maps a job with a context that ends with the operation
+			// or once the job times out. The job waits for the limiter first
+			// so the time spent waiting does not count against its timeout
+			invoke := func(j J) (R, error) {
+				if o.limiter != nil {
+					if !o.limiter.acquire(done) {
+						var zero R
+						return zero, ctx.Err()
+					}
+
+					start := time.Now()
+					defer func() {
+						o.limiter.release(time.Since(start))
+					}()
+				}
+
+				if o.jobTimeout == 0 {
+					return call(ctx, st, j)
+				}
+
+				jctx, jcancel := context.WithTimeout(ctx, o.jobTimeout)
+				defer jcancel()
+
+				atomic.StoreInt64(&w.stuck, time.Now().Add(2*o.jobTimeout).UnixNano())
+				defer atomic.StoreInt64(&w.stuck, 0)
+
+				r, err := call(jctx, st, j)
+				if ctx.Err() == nil && jctx.Err() == context.DeadlineExceeded {
+					return r, fmt.Errorf("%w: %w", ErrJobTimeout, context.DeadlineExceeded)
+				}
+
+				return r, err
+			}
+
+			// partial is the local fold of the outputs of this go routine
+			// when using a combiner, flushed is set once it is due
+			var partial R
+			var folded bool
+			var timer *time.Timer
+			var flushed <-chan time.Time
+			combine := func(r R) {
+				if folded {
+					partial = combiner(partial, r)
+					return
+				}
+
+				partial, folded = r, true
+				if o.flush == 0 {
+					return
+				}
+
+				// the timer has fired and been received from if it exists
+				if timer == nil {
+					timer = time.NewTimer(o.flush)
+				} else {
+					timer.Reset(o.flush)
+				}
+				flushed = timer.C
+			}
+
+			// flush passes the local fold to the reducer
+			flush := func() {
+				out <- result[R]{v: partial, ok: true}
+				partial, folded, flushed = zero, false, nil
+			}
+
+			// leave passes the local fold to the reducer before the go routine
+			// leaves the operation
+			leave := func(finished bool) (bool, error) {
+				if timer != nil {
+					timer.Stop()
+				}
+				if folded {
+					flush()
+				}
+				return finished, nil
+			}
+
+			for {
+				// give way to the operations below their share of the pool
+				if w.yield() {
+					return leave(false)
+				}
 
-	m := mapperOp{mapper, in, out, &wg, cls, clx}
-	for i := 0; i < o.mapper.count; i++ {
-		o.mapper.parallel <- m
+				var j task[J]
+				if steal != nil {
+					t, ok, closed := steal.take(worker)
+					if closed && !ok {
+						return leave(true)
+					}
+
+					if !ok {
+						// without call_feed the deques are not closed when the operation ends
+						var ended <-chan struct{}
+						if !feed {
+							ended = done
+						}
+
+						quitting, flushing := false, false
+						select {
+						case <-steal.wake:
+						case <-ended:
+						case <-flushed:
+							flushing = true
+						case <-quit:
+							quitting = true
+						case <-wake:
+						}
+						steal.awake()
+
+						if quitting {
+							return leave(false)
+						}
+						if flushing {
+							flush()
+						}
+						if ended != nil && ctx.Err() != nil {
+							return leave(true)
+						}
+						continue
+					}
+					j = t
+				} else if direct {
+					select {
+					case v, ok := <-in:
+						if !ok {
+							return leave(true)
+						}
+						j = task[J]{job: v}
+					case <-done:
+						drain()
+						return leave(true)
+					case <-flushed:
+						flush()
+						continue
+					case <-quit:
+						return leave(false)
+					case <-wake:
+						continue
+					}
+				} else {
+					select {
+					case t, ok := <-jobs:
+						if !ok {
+							return leave(true)
+						}
+						j = t
+					case <-flushed:
+						flush()
+						continue
+					case <-quit:
+						return leave(false)
+					case <-wake:
+						continue
+					}
+				}
+
+				select {
+				case <-done:
+					continue
+				default:
+				}
+
+				if j.batch == nil {
+					cur = j.job
+					if timed && j.attempts == 0 {
+						j.first = time.Now()
+					}
+					j.attempts++
+
+					r, err := invoke(j.job)
+					if err != nil && retry(j, err) {
+						settle()
+						continue
+					}
+
+					if err != nil {
+						failed(j, err)
+					}
+					report(j, err)
+					settle()
+
+					if combiner != nil {
+						if err == nil {
+							combine(r)
+						}
+						continue
+					}
+
+					out <- result[R]{seq: j.seq, v: r, ok: err == nil}
+					continue
+				}
+
+				var rs []R
+				if combiner == nil {
+					rs = make([]R, 0, len(j.batch))
+				}
+			batch:
+				for _, b := range j.batch {
+					select {
+					case <-done:
+						break batch
+					default:
+					}
+
+					cur = b
+					t := task[J]{job: b, attempts: 1}
+					if timed {
+						t.first = time.Now()
+					}
+
+					r, err := invoke(b)
+					if err != nil && retry(t, err) {
+						continue
+					}
+
+					report(t, err)
+					if err != nil {
+						failed(t, err)
+						continue
+					}
+
+					if combiner != nil {
+						combine(r)
+						continue
+					}
+					rs = append(rs, r)
+				}
+
+				if combiner == nil {
+					out <- result[R]{seq: j.seq, ok: true, batch: rs}
+				}
+				settle()
+			}
+		},
+		drain: func(cause ErrTrappedPanic) {
+			trapped.trap(cause)
+			cancel(cause)
+			if direct {
+				drain()
+				return
+			}
+			if steal != nil {
+				return
+			}
+			for range jobs {
+			}
+		},
+		done: func() {
+			close(mapped)
+		},
+		cancel: func() {
+			cancel(ErrPoolClosed)
+		},
+		name:   o.tenant,
+		weight: o.weight,
+		max:    o.max,
+	}
+	if m.weight == 0 {
+		m.weight = 1
 	}
+	o.mapper.start(m)
 
-	return in, nil
+	return in, ctx, cancel
 }
@@ -2,10 +2,14 @@ package parallel
 
 import (
 	"context"
+	"errors"
 	"math"
+	"math/rand"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/redsift/go-parallel/mappers"
 	"github.com/redsift/go-parallel/reducers"
@@ -219,8 +223,9 @@ func TestPanicMap(t *testing.T) {
 	}, func(t interface{}, a interface{}) interface{} {
 		return t.(int) + a.(int)
 	}, func(_ interface{}, err error) {
-		if pnk := err.(ErrTrappedPanic).Panic; pnk != "junk" {
-			t.Error("unexpected value trapped", pnk)
+		var pnk ErrTrappedPanic
+		if !errors.As(err, &pnk) || pnk.Panic != "junk" {
+			t.Error("unexpected value trapped", err)
 		}
 		and.Done()
 	})
@@ -247,8 +252,9 @@ func TestPanicReduce(t *testing.T) {
 	}, func(t interface{}, a interface{}) interface{} {
 		panic("junk")
 	}, func(_ interface{}, err error) {
-		if pnk := err.(ErrTrappedPanic).Panic; pnk != "junk" {
-			t.Error("unexpected value trapped", pnk)
+		var pnk ErrTrappedPanic
+		if !errors.As(err, &pnk) || pnk.Panic != "junk" {
+			t.Error("unexpected value trapped", err)
 		}
 		and.Done()
 	})
@@ -265,6 +271,57 @@ func TestPanicReduce(t *testing.T) {
 	and.Wait()
 }
 
+func TestPanicAll(t *testing.T) {
+	const sz = maxTrappedPanics + 8
+
+	m, c := OptMappers(sz, nil, nil)
+	defer c()
+
+	// every go routine panics once they all hold a job
+	var barrier sync.WaitGroup
+	barrier.Add(sz)
+
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		barrier.Done()
+		barrier.Wait()
+		panic(j)
+	}, nil, m, OptQueue(sz))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < sz; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	_, err = op.Wait(context.Background())
+
+	var all ErrTrappedPanics
+	if !errors.As(err, &all) || len(all.Panics) != maxTrappedPanics || all.Dropped != 8 {
+		t.Fatal("unexpected error", err)
+	}
+
+	workers := make(map[int]bool)
+	for _, pnk := range all.Panics {
+		if pnk.Phase != PhaseMap || pnk.Panic != pnk.Job || len(pnk.Stack) == 0 {
+			t.Error("unexpected panic", pnk.summary())
+		}
+		workers[pnk.Worker] = true
+	}
+
+	if len(workers) != maxTrappedPanics {
+		t.Error("unexpected workers", workers)
+	}
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) {
+		t.Error("unexpected error", err)
+	}
+}
+
 func BenchmarkSimple(b *testing.B) {
 	var and sync.WaitGroup
 
@@ -443,3 +500,564 @@ func TestMapperCancelled(t *testing.T) {
 	}
 
 }
+
+func TestParallelOf(t *testing.T) {
+	m, c := OptMappersOf(2, func(i int) *int64 {
+		v := int64(10)
+		return &v
+	}, nil)
+	defer c()
+
+	var and sync.WaitGroup
+	and.Add(1)
+
+	var total int64
+
+	q, err := ParallelOf(int64(0), func(scale *int64, j int) int64 {
+		return *scale * int64(j)
+	}, func(p int64, c int64) int64 {
+		return p + c
+	}, func(v int64, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		total = v
+		and.Done()
+	}, m)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []int{0, 1, 2, -1} {
+		q <- v
+	}
+	close(q)
+
+	and.Wait()
+
+	if total != 20 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestParallelOfMapperMismatch(t *testing.T) {
+	m, c := OptMappersOf(2, func(i int) string {
+		return "junk"
+	}, nil)
+	defer c()
+
+	_, err := ParallelOf(0, func(_ int, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, nil, m)
+
+	if err != ErrOptInvalidValueMappers {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestParallelOfUntypedPool(t *testing.T) {
+	p := NewPool(2, func(i int) interface{} {
+		return rand.New(rand.NewSource(int64(i)))
+	}, nil)
+	defer p.Cancel()
+
+	op, err := StartOf(0, func(r *rand.Rand, j int) int {
+		return j + r.Intn(1)
+	}, func(p int, c int) int {
+		return p + c
+	}, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	if total, err := op.Wait(context.Background()); err != nil || total != 55 {
+		t.Error("unexpected result", total, err)
+	}
+
+	// the `init` values of the untyped pool are checked at run time
+	mismatch, err := StartOf(0, func(s string, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := mismatch.Submit(context.Background(), i); err != nil && !errors.Is(err, ErrOptInvalidValueMappers) {
+			t.Fatal(err)
+		}
+	}
+	mismatch.CloseInput()
+
+	if _, err := mismatch.Wait(context.Background()); !errors.Is(err, ErrOptInvalidValueMappers) {
+		t.Error("unexpected error", err)
+	}
+}
+
+var errOdd = errors.New("odd job")
+
+func oddFails(_ interface{}, j interface{}) (interface{}, error) {
+	if j.(int)%2 != 0 {
+		return nil, errOdd
+	}
+	return j, nil
+}
+
+func TestParallelErrFailFast(t *testing.T) {
+	var and sync.WaitGroup
+	and.Add(1)
+
+	q, err := ParallelErr(0, oddFails, func(t interface{}, a interface{}) interface{} {
+		return t.(int) + a.(int)
+	}, func(v interface{}, err error) {
+		if err != errOdd {
+			t.Error("unexpected error", err)
+		}
+		if v != nil {
+			t.Error("unexpected value", v)
+		}
+		and.Done()
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		q <- i
+	}
+	close(q)
+
+	and.Wait()
+}
+
+func TestParallelErrCollectAll(t *testing.T) {
+	var and sync.WaitGroup
+	and.Add(1)
+
+	var total int
+
+	q, err := ParallelErr(0, oddFails, func(t interface{}, a interface{}) interface{} {
+		return t.(int) + a.(int)
+	}, func(v interface{}, err error) {
+		if !errors.Is(err, errOdd) {
+			t.Error("unexpected error", err)
+		}
+
+		var multi ErrMulti
+		if !errors.As(err, &multi) || len(multi.Errs) != 2 {
+			t.Error("unexpected errors", err)
+		}
+
+		total = v.(int)
+		and.Done()
+	}, OptFailure(CollectAll))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []int{0, 1, 2, -1, 4} {
+		q <- v
+	}
+	close(q)
+
+	and.Wait()
+
+	if total != 6 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestParallelErrSkipAndContinue(t *testing.T) {
+	var and sync.WaitGroup
+	and.Add(1)
+
+	var total int
+
+	q, err := ParallelErr(0, oddFails, func(t interface{}, a interface{}) interface{} {
+		return t.(int) + a.(int)
+	}, func(v interface{}, err error) {
+		if err != nil {
+			t.Error("unexpected error", err)
+		}
+		total = v.(int)
+		and.Done()
+	}, OptFailure(SkipAndContinue))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []int{0, 1, 2, -1, 4} {
+		q <- v
+	}
+	close(q)
+
+	and.Wait()
+
+	if total != 6 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	for _, window := range []int{1, 3, 64} {
+		list := reducers.NewStringList(100)
+
+		q, err := Parallel(list.Value(), func(_ interface{}, j interface{}) interface{} {
+			// finish out of order
+			time.Sleep(time.Duration(j.(int)%7) * time.Millisecond)
+			return strconv.Itoa(j.(int))
+		}, list.Reducer(), list.Then(), OptOrdered(), OptReorderWindow(window))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 100; i++ {
+			q <- i
+		}
+		close(q)
+
+		all, err := list.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(all) != 100 {
+			t.Fatal("unexpected length", len(all))
+		}
+
+		for i, v := range all {
+			if v != strconv.Itoa(i) {
+				t.Fatal("out of order", window, i, v)
+			}
+		}
+	}
+}
+
+func TestOrderedSkip(t *testing.T) {
+	list := reducers.NewStringList(5)
+
+	q, err := ParallelErr(list.Value(), func(_ interface{}, j interface{}) (interface{}, error) {
+		if j.(int)%2 != 0 {
+			return nil, errOdd
+		}
+		return strconv.Itoa(j.(int)), nil
+	}, list.Reducer(), list.Then(), OptOrdered(), OptFailure(SkipAndContinue))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 7; i++ {
+		q <- i
+	}
+	close(q)
+
+	all, err := list.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 4 || all[0] != "0" || all[1] != "2" || all[2] != "4" || all[3] != "6" {
+		t.Error("unexpected output", all)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	for _, sz := range []int{1, 3, 64, 2000} {
+		add := reducers.NewAssociativeInt64(0, reducers.Add)
+
+		q, err := Parallel(add.Value(), mappers.Noop, add.Reducer(), add.Then(), OptBatch(sz, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := int64(1); i <= 1000; i++ {
+			q <- i
+		}
+		close(q)
+
+		total, err := add.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if total != 500500 {
+			t.Error("total incorrect", sz, total)
+		}
+	}
+}
+
+func TestBatchDelay(t *testing.T) {
+	in, out, errc := Map(mappers.Noop, OptBatch(100, time.Millisecond))
+
+	// the partial batch is dispatched before the job queue is closed
+	in <- 1
+	in <- 2
+	if v := <-out; v != 1 {
+		t.Error("unexpected output", v)
+	}
+	if v := <-out; v != 2 {
+		t.Error("unexpected output", v)
+	}
+	close(in)
+
+	for range out {
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchOrderedSkip(t *testing.T) {
+	list := reducers.NewStringList(50)
+
+	q, err := ParallelErr(list.Value(), func(_ interface{}, j interface{}) (interface{}, error) {
+		if j.(int)%2 != 0 {
+			return nil, errOdd
+		}
+		time.Sleep(time.Duration(j.(int)%3) * time.Millisecond)
+		return strconv.Itoa(j.(int)), nil
+	}, list.Reducer(), list.Then(), OptBatch(7, 0), OptOrdered(), OptFailure(SkipAndContinue))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		q <- i
+	}
+	close(q)
+
+	all, err := list.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 50 {
+		t.Fatal("unexpected length", len(all))
+	}
+
+	for i, v := range all {
+		if v != strconv.Itoa(i*2) {
+			t.Fatal("out of order", i, v)
+		}
+	}
+}
+
+func TestCombiner(t *testing.T) {
+	m, c := OptMappers(2, nil, nil)
+	defer c()
+
+	for _, batch := range []int{1, 10} {
+		add := reducers.NewAssociativeInt64(0, reducers.Add)
+
+		var reduced int32
+		reducer := add.Reducer()
+
+		q, err := Parallel(add.Value(), mappers.Noop, func(p interface{}, c interface{}) interface{} {
+			atomic.AddInt32(&reduced, 1)
+			return reducer(p, c)
+		}, add.Then(), m, OptCombiner(add.Combiner(), 0), OptBatch(batch, 0))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := int64(1); i <= 1000; i++ {
+			q <- i
+		}
+		close(q)
+
+		total, err := add.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if total != 500500 {
+			t.Error("total incorrect", total)
+		}
+
+		// at most one fold per mapper go routine
+		if reduced > 2 {
+			t.Error("unexpected number of reductions", reduced)
+		}
+	}
+}
+
+func TestCombinerAssociative(t *testing.T) {
+	add := reducers.NewAssociativeInt64(0, reducers.Add)
+	if !reducers.Associative(add.Reducer()) || reducers.Associative(reducers.NewStringList(0).Reducer()) {
+		t.Fatal("unexpected associative reducers")
+	}
+
+	// the outputs are folded with the reducer, including the ones that are nil
+	q, err := Parallel(add.Value(), func(_ interface{}, j interface{}) interface{} {
+		if j.(int64)%2 == 0 {
+			return nil
+		}
+		return j
+	}, add.Reducer(), add.Then())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := int64(1); i <= 1000; i++ {
+		q <- i
+	}
+	close(q)
+
+	total, err := add.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 250000 {
+		t.Error("total incorrect", total)
+	}
+}
+
+// notAssociative has a method with the signature of a reducer
+type notAssociative struct{}
+
+func (notAssociative) reduce(p interface{}, v interface{}) interface{} {
+	return p
+}
+
+func TestCombinerNotAssociative(t *testing.T) {
+	add := reducers.NewAssociativeInt64(0, reducers.Add)
+	list := reducers.NewStringList(0)
+
+	for name, r := range map[string]func(interface{}, interface{}) interface{}{
+		"nil":     nil,
+		"list":    list.Reducer(),
+		"method":  notAssociative{}.reduce,
+		"closure": func(p interface{}, v interface{}) interface{} { return add.Reducer()(p, v) },
+	} {
+		if reducers.Associative(r) {
+			t.Error("unexpected associative reducer", name)
+		}
+	}
+
+	// the outputs would be folded into lists that the reducer can not append
+	q, err := Parallel(list.Value(), func(_ interface{}, j interface{}) interface{} {
+		return j
+	}, list.Reducer(), list.Then())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		q <- "a"
+	}
+	close(q)
+
+	l, err := list.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l) != 100 {
+		t.Error("length incorrect", len(l))
+	}
+}
+
+func TestCombinerFlush(t *testing.T) {
+	in, out, errc := MapOf(func(_ interface{}, j int) int {
+		return j
+	}, OptCombinerOf(func(a, b int) int {
+		return a + b
+	}, time.Nanosecond))
+
+	// the local fold is flushed before the job queue is closed
+	in <- 1
+	time.Sleep(time.Millisecond)
+	in <- 2
+
+	total := <-out
+	if total != 1 && total != 3 {
+		t.Error("unexpected output", total)
+	}
+	close(in)
+
+	for v := range out {
+		total += v
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 3 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestCombinerFlushIdle(t *testing.T) {
+	in, out, errc := MapOf(func(_ interface{}, j int) int {
+		return j
+	}, OptCombinerOf(func(a, b int) int {
+		return a + b
+	}, 5*time.Millisecond))
+
+	// the local fold is flushed while the mapper waits for the next job
+	in <- 1
+	in <- 2
+
+	select {
+	case total := <-out:
+		if total != 3 && total != 1 {
+			t.Error("unexpected output", total)
+		}
+	case <-time.After(time.Second):
+		t.Error("local fold was not flushed")
+	}
+	close(in)
+
+	for range out {
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCombinerInvalid(t *testing.T) {
+	_, err := ParallelOf(0, func(_ interface{}, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, nil, OptCombinerOf(func(a, b string) string {
+		return a + b
+	}, 0))
+
+	if err != ErrOptInvalidValueCombiner {
+		t.Error("unexpected error", err)
+	}
+
+	_, err = Parallel(0, mappers.Noop, nil, nil, OptCombiner(func(a, b interface{}) interface{} {
+		return a
+	}, 0), OptOrdered())
+
+	if err != ErrOptInvalidValueCombiner {
+		t.Error("unexpected error", err)
+	}
+}
@@ -0,0 +1,127 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPipelineEmpty indicates a pipeline was started without any stages
+var ErrPipelineEmpty = errors.New("pipeline has no stages")
+
+// Pipeline chains stages of mappers where the outputs of each stage are the jobs of the next,
+// every stage has its own goroutine pool and job queue so backpressure flows from the slowest
+// stage to the submitter. The stages share a single context and the first error or trapped panic
+// of any stage cancels the whole pipeline
+type Pipeline struct {
+	ctx    context.Context
+	stages []stage
+}
+
+type stage struct {
+	mapper func(init interface{}, job interface{}) (interface{}, error)
+	opts   []Option
+}
+
+// NewPipeline returns an empty pipeline, ctx is used to cancel every stage
+func NewPipeline(ctx context.Context) *Pipeline {
+	return &Pipeline{ctx: ctx}
+}
+
+// Stage appends a stage to the pipeline, opts control the queue size, goroutine pool & `init`
+// values and failure policy of the stage. OptContext is ignored as the context of the
+// pipeline is used
+func (p *Pipeline) Stage(mapper func(init interface{}, job interface{}) (interface{}, error), opts ...Option) *Pipeline {
+	p.stages = append(p.stages, stage{mapper, opts})
+	return p
+}
+
+// StageOf appends a typed stage to the pipeline, J must match the outputs of the
+// previous stage
+func StageOf[S, J, R any](p *Pipeline, mapper func(init S, job J) (R, error), opts ...Option) *Pipeline {
+	return p.Stage(func(s interface{}, j interface{}) (interface{}, error) {
+		return mapper(stateOf[S](s), j.(J))
+	}, opts...)
+}
+
+// Start runs the pipeline, the returned Op submits jobs to the first stage and Wait returns
+// the reduction of the outputs of the last stage. reducer is optional, without it the outputs
+// of the last stage are discarded and Wait returns value
+func (p *Pipeline) Start(value interface{},
+	reducer func(previous interface{}, current interface{}) interface{}) (*Op, error) {
+
+	if len(p.stages) == 0 {
+		return nil, ErrPipelineEmpty
+	}
+
+	ctx, cancel := context.WithCancelCause(p.ctx)
+
+	all := make([]*options, 0, len(p.stages))
+	for _, s := range p.stages {
+		o, err := makeOptionsOf[interface{}, interface{}](append(s.opts[:len(s.opts):len(s.opts)], OptContext(ctx)))
+		if err != nil {
+			for _, o := range all {
+				if o.cancel != nil {
+					o.cancel()
+				}
+			}
+			cancel(err)
+			return nil, err
+		}
+		all = append(all, o)
+	}
+	all[0].owned = true
+
+	op := &Op{cancel: cancel, done: make(chan struct{})}
+
+	// first is the first error of any stage
+	var first error
+	var firstMu sync.Mutex
+	fail := func(err error) error {
+		firstMu.Lock()
+		defer firstMu.Unlock()
+
+		if first == nil {
+			first = err
+			cancel(err)
+		}
+
+		return first
+	}
+
+	// start from the last stage so each stage can forward its outputs to the next
+	var next chan interface{}
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		o, mapper := all[i], p.stages[i].mapper
+
+		if next == nil {
+			next, _, _ = parallel(o, value, mapper, reducer, func(final interface{}, err error) {
+				if err != nil {
+					final, err = nil, fail(err)
+				}
+
+				op.value, op.err = final, err
+				cancel(nil)
+				close(op.done)
+			})
+			continue
+		}
+
+		to := next
+		next, _, _ = parallel(o, struct{}{}, mapper, func(_ struct{}, r interface{}) struct{} {
+			select {
+			case to <- r:
+			case <-ctx.Done():
+			}
+			return struct{}{}
+		}, func(_ struct{}, err error) {
+			if err != nil {
+				fail(err)
+			}
+			close(to)
+		})
+	}
+	op.input = newInput(ctx, next)
+
+	return op, nil
+}
@@ -0,0 +1,138 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/redsift/go-parallel/reducers"
+)
+
+func TestPipeline(t *testing.T) {
+	m, c := OptMappers(3, nil, nil)
+	defer c()
+
+	p := NewPipeline(context.Background())
+	StageOf(p, func(_ interface{}, j int) (string, error) {
+		return strconv.Itoa(j), nil
+	}, OptQueue(1))
+	StageOf(p, func(_ interface{}, j string) (int64, error) {
+		v, err := strconv.Atoi(j)
+		return int64(v) * 2, err
+	}, m)
+
+	add := reducers.NewAssociativeInt64(0, reducers.Add)
+	op, err := p.Start(add.Value(), add.Reducer())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 100; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	total, err := add.Result(op.Wait(context.Background()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 10100 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestPipelineError(t *testing.T) {
+	op, err := NewPipeline(context.Background()).Stage(func(_ interface{}, j interface{}) (interface{}, error) {
+		if j.(int) == 10 {
+			return nil, errOdd
+		}
+		return j, nil
+	}).Stage(func(_ interface{}, j interface{}) (interface{}, error) {
+		return j, nil
+	}).Start(0, func(p interface{}, c interface{}) interface{} {
+		return p.(int) + c.(int)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var serr error
+	for i := 0; i < 1000 && serr == nil; i++ {
+		serr = op.Submit(context.Background(), i)
+	}
+	op.CloseInput()
+
+	if !errors.Is(serr, errOdd) && serr != nil {
+		t.Error("unexpected error", serr)
+	}
+
+	if _, err := op.Wait(context.Background()); err != errOdd {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPipelinePanic(t *testing.T) {
+	op, err := NewPipeline(context.Background()).Stage(func(_ interface{}, j interface{}) (interface{}, error) {
+		return j, nil
+	}).Stage(func(_ interface{}, j interface{}) (interface{}, error) {
+		panic("junk")
+	}).Start(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			break
+		}
+	}
+	op.CloseInput()
+
+	_, err = op.Wait(context.Background())
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) || pnk.Panic != "junk" {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	op, err := NewPipeline(ctx).Stage(func(_ interface{}, j interface{}) (interface{}, error) {
+		return j, nil
+	}).Start(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	if err := op.Submit(context.Background(), 1); !errors.Is(err, ErrOpCancelled) {
+		t.Error("unexpected error", err)
+	}
+
+	if _, err := op.Wait(context.Background()); err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPipelineInvalid(t *testing.T) {
+	if _, err := NewPipeline(context.Background()).Start(nil, nil); err != ErrPipelineEmpty {
+		t.Error("unexpected error", err)
+	}
+
+	_, err := NewPipeline(context.Background()).Stage(func(_ interface{}, j interface{}) (interface{}, error) {
+		return j, nil
+	}).Stage(func(_ interface{}, j interface{}) (interface{}, error) {
+		return j, nil
+	}, OptQueue(0)).Start(nil, nil)
+
+	if err != ErrOptInvalidValueQueue {
+		t.Error("unexpected error", err)
+	}
+}
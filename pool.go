@@ -0,0 +1,502 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrInvalidPoolSize indicates a pool was resized to less than one go routine
+	ErrInvalidPoolSize = errors.New("invalid pool size")
+
+	// ErrPoolClosed is the cause of the cancellation of the operations running on a pool
+	// that was closed
+	ErrPoolClosed = errors.New("pool was closed")
+)
+
+// ErrShutdown indicates go routines of a pool had not exited when the context passed to
+// Shutdown or Close ended, Workers are their indexes
+type ErrShutdown struct {
+	Workers []int
+	Err     error
+}
+
+func (e ErrShutdown) Error() string {
+	return fmt.Sprintf("%d pool go routines did not exit %v: %v", len(e.Workers), e.Workers, e.Err)
+}
+
+// Unwrap returns the error of the context
+func (e ErrShutdown) Unwrap() error {
+	return e.Err
+}
+
+type mapper struct {
+	// kind is a nil pointer to the type of the `init` values, nil if there are none
+	kind interface{}
+
+	init    func(int) interface{}
+	destroy func(interface{})
+	// healing replaces go routines that panic instead of trapping the panic in the pool
+	healing bool
+	// fair shares the go routines between the operations by weight instead of in order
+	fair bool
+
+	// resizing serialises Resize so `init` can be called without holding mu
+	resizing sync.Mutex
+
+	// mu guards the fields below, cond is signalled when an operation is added,
+	// a worker is told to quit or the pool is cancelled
+	mu      sync.Mutex
+	cond    *sync.Cond
+	workers []*worker
+	// ops are the operations with jobs left to map, in the order they were started
+	ops    []*mapperOp
+	closed bool
+	// live are the go routines that have not exited, including the ones told to quit,
+	// exited is closed once the pool is closed and they have all been destroyed
+	live   map[*worker]struct{}
+	exited chan struct{}
+
+	trapped atomic.Value
+}
+
+// worker is a mapper go routine, quit is closed when the pool shrinks below its index
+// and wake is signalled when the go routine should check if it must yield its operation
+type worker struct {
+	index int
+	quit  chan struct{}
+	wake  chan struct{}
+	// op is the operation the go routine is attached to, guarded by the mu of the mapper
+	op *mapperOp
+	// stuck is the time in ns after which the go routine is stuck on its current job,
+	// 0 if the job has no timeout
+	stuck int64
+}
+
+// mapperOp is shared by the mapper go routines for each Parallel operation
+type mapperOp struct {
+	// run consumes jobs using the `init` value of the go routine w until the job
+	// queue is closed, in which case it returns true, or quit is closed. A panic
+	// in the mapper is trapped and returned
+	run func(s interface{}, w *worker) (bool, error)
+	// drain cancels the operation and unblocks the job queue after a panic
+	drain func(cause ErrTrappedPanic)
+	// done is called once the job queue is closed and every go routine has left
+	done func()
+	// cancel ends the operation when the pool is closed
+	cancel func()
+
+	// name, weight and max are set by OptTenant
+	name   string
+	weight int
+	max    int
+
+	// attached and finished are guarded by the mu of the mapper
+	attached int
+	finished bool
+	// excess is the number of go routines that should yield the operation to others
+	excess int32
+}
+
+func newMapper(sz int, init func(int) interface{}, destroy func(interface{}), opts ...PoolOption) (*mapper, CancelFunc) {
+	m := &mapper{init: init, destroy: destroy, live: make(map[*worker]struct{}), exited: make(chan struct{})}
+	m.cond = sync.NewCond(&m.mu)
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	for i := 0; i < sz; i++ {
+		m.spawn(i)
+	}
+
+	return m, func() {
+		m.trapped.Store(ErrTrappedPanic{Panic: ErrCancelledMapper})
+
+		m.close()
+	}
+}
+
+// close stops the go routines once there are no operations left, it returns the
+// operations that are still running
+func (m *mapper) close() []*mapperOp {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	m.cond.Broadcast()
+	m.settle()
+
+	return append([]*mapperOp(nil), m.ops...)
+}
+
+// settle closes exited if the pool is closed and every go routine has exited, mu must be held
+func (m *mapper) settle() {
+	if !m.closed || len(m.live) > 0 {
+		return
+	}
+
+	select {
+	case <-m.exited:
+	default:
+		close(m.exited)
+	}
+}
+
+// exit removes w from the live go routines once it has been destroyed
+func (m *mapper) exit(w *worker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.live, w)
+	m.settle()
+}
+
+// wait blocks until every go routine has exited or ctx ends, the pool can not be used after
+func (m *mapper) wait(ctx context.Context) error {
+	defer m.trapped.Store(ErrTrappedPanic{Panic: ErrCancelledMapper})
+
+	select {
+	case <-m.exited:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	workers := make([]int, 0, len(m.live))
+	for w := range m.live {
+		workers = append(workers, w.index)
+	}
+	sort.Ints(workers)
+
+	return ErrShutdown{Workers: workers, Err: ctx.Err()}
+}
+
+// size is the number of go routines the pool is sized for
+func (m *mapper) size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.workers)
+}
+
+// spawn starts the go routine with index i
+func (m *mapper) spawn(i int) {
+	var s interface{}
+	if m.init != nil {
+		s = m.init(i)
+	}
+
+	w := &worker{index: i, quit: make(chan struct{}), wake: make(chan struct{}, 1)}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+
+		if m.destroy != nil {
+			m.destroy(s)
+		}
+		return
+	}
+	m.workers = append(m.workers, w)
+	m.live[w] = struct{}{}
+	m.mu.Unlock()
+
+	// call_map
+	go func() {
+		defer func() {
+			if m.destroy != nil {
+				m.destroy(s)
+			}
+			m.exit(w)
+		}()
+
+		for {
+			op := m.next(w)
+			if op == nil {
+				return
+			}
+
+			finished, err := op.run(s, w)
+			if err == nil {
+				m.leave(w, finished)
+				continue
+			}
+			pnk := err.(ErrTrappedPanic)
+
+			// drain the jobs as we don't want the writer to block
+			op.drain(pnk)
+
+			if !m.healing {
+				m.trapped.Store(pnk)
+				m.leave(w, true)
+				return
+			}
+
+			// replace the `init` value as the panic may have left it inconsistent
+			if m.destroy != nil {
+				m.destroy(s)
+			}
+			s = nil
+			if m.init != nil {
+				s = m.init(i)
+			}
+			m.leave(w, true)
+		}
+	}()
+}
+
+// resize starts or stops go routines until there are sz of them, stopped go routines
+// finish their current job before leaving their operation. The index of a go routine is
+// not reused until it has exited
+func (m *mapper) resize(sz int) error {
+	if sz < 1 {
+		return ErrInvalidPoolSize
+	}
+
+	m.resizing.Lock()
+	defer m.resizing.Unlock()
+
+	if err := m.trapped.Load(); err != nil {
+		if pnk := err.(ErrTrappedPanic); pnk.Panic == ErrCancelledMapper {
+			return ErrCancelledMapper
+		}
+		return err.(error)
+	}
+
+	m.mu.Lock()
+	n := len(m.workers)
+	if sz < n {
+		for i, w := range m.workers[sz:] {
+			close(w.quit)
+			m.workers[sz+i] = nil
+		}
+		m.workers = m.workers[:sz]
+		m.rebalance()
+		m.cond.Broadcast()
+	}
+
+	// stopped go routines keep their index until they exit, the new ones take the
+	// lowest indexes that are free
+	used := make(map[int]bool, len(m.live))
+	for w := range m.live {
+		used[w.index] = true
+	}
+	m.mu.Unlock()
+
+	for i := 0; n < sz; i++ {
+		if !used[i] {
+			m.spawn(i)
+			n++
+		}
+	}
+
+	return nil
+}
+
+// start makes op available to the go routines of the pool
+func (m *mapper) start(op *mapperOp) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		panic(ErrTrappedPanic{Panic: ErrCancelledMapper}) // can't reuse after Shutdown
+	}
+
+	m.ops = append(m.ops, op)
+	m.rebalance()
+	m.cond.Broadcast()
+}
+
+// next blocks until there is an operation for w to join, it returns nil if w should exit
+func (m *mapper) next(w *worker) *mapperOp {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		select {
+		case <-w.quit:
+			return nil
+		default:
+		}
+
+		if op := m.pick(); op != nil {
+			op.attached++
+			w.op = op
+			m.rebalance()
+			return op
+		}
+
+		if m.closed {
+			return nil
+		}
+
+		m.cond.Wait()
+	}
+}
+
+// leave detaches w from its operation, finished is set if it saw the job queue close
+func (m *mapper) leave(w *worker, finished bool) {
+	m.mu.Lock()
+
+	op := w.op
+	w.op = nil
+	op.attached--
+	if finished && !op.finished {
+		op.finished = true
+		for i, o := range m.ops {
+			if o == op {
+				m.ops = append(m.ops[:i], m.ops[i+1:]...)
+				break
+			}
+		}
+	}
+	end := op.finished && op.attached == 0
+
+	// the operation may be below its cap or share again
+	if m.fair || op.max > 0 {
+		m.rebalance()
+		m.cond.Broadcast()
+	}
+
+	m.mu.Unlock()
+
+	if end {
+		op.done()
+	}
+}
+
+// PoolOption configures a Pool
+type PoolOption func(*mapper)
+
+// OptSelfHealing makes the pool survive a panic in a mapper. The panic is only reported to
+// the operation it happened in, the `init` value of the go routine is passed to `destroy` and
+// replaced by a new one from `init`. Without it the pool can not be used after a panic
+func OptSelfHealing() PoolOption {
+	return func(m *mapper) {
+		m.healing = true
+	}
+}
+
+// Pool is a mapper go routine pool that can be shared by operations and resized while
+// they run
+type Pool struct {
+	m      *mapper
+	cancel CancelFunc
+}
+
+// NewPool starts a pool of sz go routines (defaults to runtime.NumCPU()) and supplies
+// `init` and `destroy` hooks for the routines, see OptMappers
+func NewPool(sz int, init func(int) interface{}, destroy func(interface{}), opts ...PoolOption) *Pool {
+	return newPool((*interface{})(nil), sz, init, destroy, opts)
+}
+
+// NewPoolOf is the typed equivalent of NewPool, the `init` values are passed
+// to the mappers of ParallelOf without a cast
+func NewPoolOf[S any](sz int, init func(int) S, destroy func(S), opts ...PoolOption) *Pool {
+	var i func(int) interface{}
+	if init != nil {
+		i = func(n int) interface{} {
+			return init(n)
+		}
+	}
+
+	var d func(interface{})
+	if destroy != nil {
+		d = func(s interface{}) {
+			destroy(stateOf[S](s))
+		}
+	}
+
+	return newPool((*S)(nil), sz, i, d, opts)
+}
+
+func newPool(kind interface{}, sz int, init func(int) interface{}, destroy func(interface{}), opts []PoolOption) *Pool {
+	if sz < 1 {
+		sz = runtime.NumCPU() // cant change after process is started
+	}
+	m, c := newMapper(sz, init, destroy, opts...)
+	m.kind = kind
+
+	return &Pool{m: m, cancel: c}
+}
+
+// Option returns the option that runs the mappers of an operation on the pool
+func (p *Pool) Option() Option {
+	return func(o *options) error {
+		o.mapper = p.m
+		return nil
+	}
+}
+
+// Size returns the number of go routines the pool is sized for, stopped go routines may
+// still be finishing their current job
+func (p *Pool) Size() int {
+	return p.m.size()
+}
+
+// Resize grows or shrinks the pool to sz go routines. New go routines are created with
+// `init` and join the running operations, stopped go routines finish their current job,
+// then leave their operation and are passed to `destroy`. No jobs are lost while resizing.
+// New go routines take the lowest indexes that are not held by a go routine that has yet to
+// exit, so the indexes passed to `init` may exceed the size while stopped ones finish
+func (p *Pool) Resize(sz int) error {
+	return p.m.resize(sz)
+}
+
+// Stuck returns the indexes of the go routines that ignored the end of the context of a
+// job that timed out with OptJobTimeout, for as long again as the timeout. Go routines
+// stopped by Resize are reported until they exit. The pools of OptMappers can not be
+// inspected, use NewPool to call Stuck
+func (p *Pool) Stuck() []int {
+	p.m.mu.Lock()
+	defer p.m.mu.Unlock()
+
+	now := time.Now().UnixNano()
+
+	var stuck []int
+	for w := range p.m.live {
+		if at := atomic.LoadInt64(&w.stuck); at != 0 && now > at {
+			stuck = append(stuck, w.index)
+		}
+	}
+	sort.Ints(stuck)
+
+	return stuck
+}
+
+// Cancel shuts down the go routines of the pool once the operations already started
+// on it complete, it is the CancelFunc of OptMappers. It does not wait for them
+func (p *Pool) Cancel() {
+	p.cancel()
+}
+
+// Shutdown stops the pool from accepting operations, waits for the operations already
+// started on it to complete, then for every go routine to exit and be passed to `destroy`.
+// If ctx ends first an ErrShutdown lists the go routines that are still running. The pool
+// can not be used after
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.m.close()
+
+	return p.m.wait(ctx)
+}
+
+// Close cancels the operations running on the pool with ErrPoolClosed as the cause, then
+// waits for every go routine to exit and be passed to `destroy`. If ctx ends first, as a
+// mapper ignores the end of its context, an ErrShutdown lists the go routines that are
+// still running. The pool can not be used after
+func (p *Pool) Close(ctx context.Context) error {
+	for _, op := range p.m.close() {
+		op.cancel()
+	}
+
+	return p.m.wait(ctx)
+}
@@ -0,0 +1,460 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// eventually fails the test if cond does not hold within 10 seconds
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	for end := time.Now().Add(10 * time.Second); !cond(); {
+		if time.Now().After(end) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolResize(t *testing.T) {
+	var inits, destroys int32
+	p := NewPoolOf(1, func(i int) int {
+		atomic.AddInt32(&inits, 1)
+		return i
+	}, func(int) {
+		atomic.AddInt32(&destroys, 1)
+	})
+	defer p.Cancel()
+
+	var active int32
+	gate := make(chan struct{})
+	op, err := StartOf(0, func(_ int, j int) int {
+		atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+
+		<-gate
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, p.Option(), OptQueue(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 100; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eventually(t, func() bool { return atomic.LoadInt32(&active) == 1 })
+
+	if err := p.Resize(4); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new go routines join the running operation
+	eventually(t, func() bool { return atomic.LoadInt32(&active) == 4 })
+
+	if n := atomic.LoadInt32(&inits); n != 4 {
+		t.Error("unexpected inits", n)
+	}
+
+	if err := p.Resize(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Size() != 1 {
+		t.Error("unexpected size", p.Size())
+	}
+
+	close(gate)
+	op.CloseInput()
+
+	total, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 5050 {
+		t.Error("total incorrect", total)
+	}
+
+	eventually(t, func() bool { return atomic.LoadInt32(&destroys) == 3 })
+
+	// the pool is still usable once shrunk
+	op, err = StartOf(0, func(_ int, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	if total, err := op.Wait(context.Background()); err != nil || total != 55 {
+		t.Error("unexpected result", total, err)
+	}
+}
+
+func TestPoolResizeIndexes(t *testing.T) {
+	var mu sync.Mutex
+	var indexes []int
+	p := NewPool(4, func(i int) interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+
+		indexes = append(indexes, i)
+		return nil
+	}, nil)
+	defer p.Cancel()
+
+	var active int32
+	gate := make(chan struct{})
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		atomic.AddInt32(&active, 1)
+		<-gate
+		return j
+	}, nil, p.Option(), OptQueue(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eventually(t, func() bool { return atomic.LoadInt32(&active) == 4 })
+
+	// 1, 2 and 3 are still mapping their job when the pool grows again
+	if err := p.Resize(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Resize(3); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if fmt.Sprint(indexes) != "[0 1 2 3 4 5]" {
+		t.Error("unexpected indexes", indexes)
+	}
+	mu.Unlock()
+
+	close(gate)
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolResizeInvalid(t *testing.T) {
+	p := NewPool(2, nil, nil)
+
+	if err := p.Resize(0); err != ErrInvalidPoolSize {
+		t.Error("unexpected error", err)
+	}
+
+	p.Cancel()
+
+	if err := p.Resize(4); err != ErrCancelledMapper {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPoolPanicOtherOp(t *testing.T) {
+	p := NewPool(2, nil, nil)
+	defer p.Cancel()
+
+	gate := make(chan struct{})
+	other, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		<-gate
+		return j
+	}, nil, p.Option(), OptTenant("other", 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		panic("junk")
+	}, nil, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); err == nil {
+		t.Fatal("expected a panic")
+	}
+
+	// the panic of the pool reaches the other operation in the same form
+	close(gate)
+	other.CloseInput()
+
+	_, err = other.Wait(context.Background())
+	if pnks, ok := err.(ErrTrappedPanics); !ok || len(pnks.Panics) != 1 || pnks.Panics[0].Panic != "junk" {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPoolSelfHealing(t *testing.T) {
+	var inits, destroys int32
+	p := NewPoolOf(2, func(i int) int {
+		atomic.AddInt32(&inits, 1)
+		return i
+	}, func(int) {
+		atomic.AddInt32(&destroys, 1)
+	}, OptSelfHealing())
+	defer p.Cancel()
+
+	op, err := StartOf(0, func(_ int, j int) int {
+		if j == 3 {
+			panic("junk")
+		}
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			break
+		}
+	}
+	op.CloseInput()
+
+	_, err = op.Wait(context.Background())
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) || pnk.Panic != "junk" || pnk.Job != 3 {
+		t.Error("unexpected error", err)
+	}
+
+	if n := atomic.LoadInt32(&inits); n != 3 {
+		t.Error("unexpected inits", n)
+	}
+
+	if n := atomic.LoadInt32(&destroys); n != 1 {
+		t.Error("unexpected destroys", n)
+	}
+
+	// the panic does not affect later operations
+	op, err = StartOf(0, func(_ int, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	if total, err := op.Wait(context.Background()); err != nil || total != 55 {
+		t.Error("unexpected result", total, err)
+	}
+}
+
+func TestPoolShutdown(t *testing.T) {
+	var destroys int32
+	p := NewPool(2, nil, func(interface{}) {
+		atomic.AddInt32(&destroys, 1)
+	})
+
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		time.Sleep(time.Millisecond)
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- p.Shutdown(ctx)
+	}()
+
+	// the running operation completes before the pool shuts down
+	for i := 11; i <= 20; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&destroys); n != 2 {
+		t.Error("unexpected destroys", n)
+	}
+
+	if total, err := op.Wait(context.Background()); err != nil || total != 210 {
+		t.Error("unexpected result", total, err)
+	}
+
+	if err := p.Resize(4); err != ErrCancelledMapper {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPoolShutdownDeadline(t *testing.T) {
+	p := NewPool(2, nil, nil)
+
+	release := make(chan struct{})
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		<-release
+		return j
+	}, nil, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := op.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	op.CloseInput()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = p.Shutdown(ctx)
+
+	var sd ErrShutdown
+	if !errors.As(err, &sd) || !errors.Is(err, context.DeadlineExceeded) || len(sd.Workers) != 1 {
+		t.Error("unexpected error", err)
+	}
+
+	close(release)
+}
+
+func TestPoolClose(t *testing.T) {
+	var destroys int32
+	p := NewPool(4, nil, func(interface{}) {
+		atomic.AddInt32(&destroys, 1)
+	})
+
+	op, err := StartCtx(0, func(ctx context.Context, _ interface{}, j interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, nil, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&destroys); n != 4 {
+		t.Error("unexpected destroys", n)
+	}
+
+	if err := op.Submit(context.Background(), 5); !errors.Is(err, ErrPoolClosed) {
+		t.Error("unexpected error", err)
+	}
+
+	if _, err := op.Wait(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPoolCloseDeadline(t *testing.T) {
+	p := NewPool(2, nil, nil)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		close(started)
+		<-release
+		return j
+	}, nil, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := op.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// the mapper ignores the cancellation of the operation
+	err = p.Close(ctx)
+
+	var sd ErrShutdown
+	if !errors.As(err, &sd) || !errors.Is(err, context.DeadlineExceeded) || len(sd.Workers) != 1 {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPoolCloseParallel(t *testing.T) {
+	p := NewPool(2, nil, nil)
+
+	// the job queue is never closed by the caller
+	in, err := Parallel(0, func(_ interface{}, j interface{}) interface{} {
+		return j
+	}, nil, func(interface{}, error) {}, p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in <- 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.Close(ctx); err != nil {
+		t.Error("unexpected error", err)
+	}
+}
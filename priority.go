@@ -0,0 +1,229 @@
+package parallel
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOptInvalidValuePriority indicates the aging of the priority queue is invalid
+	ErrOptInvalidValuePriority = errors.New("invalid option value: priority")
+
+	// ErrNoPriority indicates a job was submitted with a priority to an operation started
+	// without OptPriority
+	ErrNoPriority = errors.New("operation has no priority queue")
+)
+
+// OptPriority queues the jobs submitted to an Op by priority instead of in order, see
+// SubmitPriority. Jobs gain one level of priority for every aging they wait so bulk jobs
+// are not starved by a steady flow of urgent ones, an aging of 0 disables it. The size
+// of the queue is set by OptQueue and a full queue is handled by OptOverflow, where the
+// oldest job is the one that was submitted first. It has no effect on Parallel
+func OptPriority(aging time.Duration) Option {
+	return func(o *options) error {
+		if aging < 0 {
+			return ErrOptInvalidValuePriority
+		}
+		o.priority, o.aging = true, aging
+		return nil
+	}
+}
+
+// prioritized is a job in the priority queue, jobs with a greater rank are sent first
+type prioritized[J any] struct {
+	job  J
+	rank float64
+	seq  uint64
+}
+
+// jobHeap is a max heap of jobs by rank, jobs of the same rank are kept in order
+type jobHeap[J any] []prioritized[J]
+
+func (h jobHeap[J]) Len() int { return len(h) }
+
+func (h jobHeap[J]) Less(i, j int) bool { return h.before(h[i], h[j]) }
+
+// before reports whether a is sent before b
+func (jobHeap[J]) before(a, b prioritized[J]) bool {
+	if a.rank != b.rank {
+		return a.rank > b.rank
+	}
+	return a.seq < b.seq
+}
+
+func (h jobHeap[J]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap[J]) Push(x interface{}) { *h = append(*h, x.(prioritized[J])) }
+
+func (h *jobHeap[J]) Pop() interface{} {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// priorityQueue holds up to size jobs in front of the job queue of an operation
+type priorityQueue[J any] struct {
+	size  int
+	aging time.Duration
+	epoch time.Time
+
+	// mu guards the fields below, space is closed and replaced when a job leaves the queue
+	mu     sync.Mutex
+	jobs   jobHeap[J]
+	seq    uint64
+	closed bool
+	space  chan struct{}
+
+	// pushed is signalled when a job is queued or the queue is closed
+	pushed chan struct{}
+}
+
+func newPriorityQueue[J any](size int, aging time.Duration) *priorityQueue[J] {
+	return &priorityQueue[J]{
+		size:   size,
+		aging:  aging,
+		epoch:  time.Now(),
+		space:  make(chan struct{}),
+		pushed: make(chan struct{}, 1),
+	}
+}
+
+// rank orders the jobs, with aging a job waiting for aging is ranked as a job of
+// the next priority submitted now. As every job ages at the same rate the order
+// of the jobs does not change while they wait
+func (pq *priorityQueue[J]) rank(priority int) float64 {
+	if pq.aging == 0 {
+		return float64(priority)
+	}
+
+	return float64(priority) - float64(time.Since(pq.epoch))/float64(pq.aging)
+}
+
+func (pq *priorityQueue[J]) signal() {
+	select {
+	case pq.pushed <- struct{}{}:
+	default:
+	}
+}
+
+// freed wakes the go routines waiting for space, mu must be held
+func (pq *priorityQueue[J]) freed() {
+	close(pq.space)
+	pq.space = make(chan struct{})
+}
+
+// offer queues job if there is space, otherwise it returns a channel that is closed
+// once a job leaves the queue
+func (pq *priorityQueue[J]) offer(job J, priority int) (bool, <-chan struct{}) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	if len(pq.jobs) >= pq.size {
+		return false, pq.space
+	}
+
+	heap.Push(&pq.jobs, prioritized[J]{job: job, rank: pq.rank(priority), seq: pq.seq})
+	pq.seq++
+	pq.signal()
+
+	return true, nil
+}
+
+// dropOldest discards the job that was submitted first
+func (pq *priorityQueue[J]) dropOldest() bool {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	if len(pq.jobs) == 0 {
+		return false
+	}
+
+	oldest := 0
+	for i, p := range pq.jobs {
+		if p.seq < pq.jobs[oldest].seq {
+			oldest = i
+		}
+	}
+	heap.Remove(&pq.jobs, oldest)
+	pq.freed()
+
+	return true
+}
+
+// close stops accepting jobs, in is closed once the queued jobs have been sent
+func (pq *priorityQueue[J]) close() {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	pq.closed = true
+	pq.signal()
+}
+
+// pump sends the queued jobs to in by priority until the queue is closed and empty or
+// done is closed. The job waiting to be sent is swapped when a job with a higher
+// priority is queued
+func (pq *priorityQueue[J]) pump(done <-chan struct{}, in chan<- J) {
+	for {
+		pq.mu.Lock()
+		if len(pq.jobs) == 0 {
+			closed := pq.closed
+			pq.mu.Unlock()
+
+			if closed {
+				close(in)
+				return
+			}
+
+			select {
+			case <-pq.pushed:
+			case <-done:
+				return
+			}
+			continue
+		}
+		// the job leaves the queue as it is taken, like a job taken from a channel
+		p := heap.Pop(&pq.jobs).(prioritized[J])
+		pq.freed()
+		pq.mu.Unlock()
+
+		for sent := false; !sent; {
+			select {
+			case in <- p.job:
+				sent = true
+			case <-pq.pushed:
+				pq.mu.Lock()
+				if len(pq.jobs) > 0 && pq.jobs.before(pq.jobs[0], p) {
+					pq.jobs[0], p = p, pq.jobs[0]
+					heap.Fix(&pq.jobs, 0)
+				}
+				pq.mu.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// wait blocks until job is queued in the priority queue, see Submit
+func (q *input[J]) wait(ctx context.Context, job J, priority int) error {
+	for {
+		ok, space := q.pq.offer(job, priority)
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-space:
+		case <-q.closing:
+			return ErrOpClosed
+		case <-q.ctx.Done():
+			return q.cancelled()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
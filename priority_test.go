@@ -0,0 +1,190 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// positions returns the position each job was mapped in
+func positions(t *testing.T, op *OpOf[int, []int]) map[int]int {
+	t.Helper()
+
+	mapped, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos := make(map[int]int, len(mapped))
+	for i, j := range mapped {
+		pos[j] = i
+	}
+
+	return pos
+}
+
+func TestPriority(t *testing.T) {
+	gate := make(chan struct{})
+	op := startGated(t, gate, 32, OptPriority(0))
+
+	for i := 0; i < 20; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 100; i < 105; i++ {
+		if err := op.SubmitPriority(context.Background(), i, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(gate)
+	op.CloseInput()
+
+	pos := positions(t, op)
+	if len(pos) != 25 {
+		t.Fatal("unexpected jobs", len(pos))
+	}
+
+	// up to 3 jobs are already taken by the mapper, the job queue and the feeder
+	for i := 100; i < 105; i++ {
+		if pos[i] >= 8 {
+			t.Error("urgent job mapped late", i, pos[i])
+		}
+	}
+
+	// jobs of the same priority are mapped in order
+	for i := 1; i < 20; i++ {
+		if pos[i] < pos[i-1] {
+			t.Error("jobs out of order", i)
+		}
+	}
+}
+
+func TestPriorityAging(t *testing.T) {
+	gate := make(chan struct{})
+	op := startGated(t, gate, 32, OptPriority(time.Millisecond))
+
+	for i := 0; i < 20; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the bulk jobs have gained more than 10 levels of priority
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 100; i < 105; i++ {
+		if err := op.SubmitPriority(context.Background(), i, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(gate)
+	op.CloseInput()
+
+	pos := positions(t, op)
+	for i := 100; i < 105; i++ {
+		if pos[i] < 20 {
+			t.Error("bulk job starved", i, pos[i])
+		}
+	}
+}
+
+func TestPriorityOverflow(t *testing.T) {
+	gate := make(chan struct{})
+	op := startGated(t, gate, 4, OptPriority(0), OptOverflow(OverflowDropOldest))
+
+	for i := 0; i < 100; i++ {
+		if err := op.SubmitPriority(context.Background(), i, i%3); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(gate)
+	op.CloseInput()
+
+	pos := positions(t, op)
+	if st := op.Overflows(); st.Dropped == 0 || int64(len(pos))+st.Dropped != 100 {
+		t.Error("unexpected stats", st, len(pos))
+	}
+
+	if _, ok := pos[99]; !ok {
+		t.Error("newest job dropped")
+	}
+}
+
+func TestPriorityBlock(t *testing.T) {
+	gate := make(chan struct{})
+	op := startGated(t, gate, 1, OptPriority(0))
+
+	n := fill(t, op)
+
+	submitted := make(chan error)
+	go func() {
+		submitted <- op.SubmitPriority(context.Background(), n, 1)
+	}()
+
+	eventually(t, func() bool { return op.Overflows().Blocked == 1 })
+	close(gate)
+
+	if err := <-submitted; err != nil {
+		t.Fatal(err)
+	}
+	op.CloseInput()
+
+	if pos := positions(t, op); len(pos) != n+1 {
+		t.Error("unexpected jobs", len(pos), n+1)
+	}
+}
+
+func TestPriorityCancel(t *testing.T) {
+	gate := make(chan struct{})
+	defer close(gate)
+
+	op := startGated(t, gate, 32, OptPriority(0))
+
+	for i := 0; i < 10; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	op.Cancel()
+
+	if err := op.SubmitPriority(context.Background(), 10, 1); !errors.Is(err, ErrOpCancelled) {
+		t.Error("unexpected error", err)
+	}
+
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestPriorityNone(t *testing.T) {
+	gate := make(chan struct{})
+	close(gate)
+
+	op := startGated(t, gate, 2)
+
+	if err := op.SubmitPriority(context.Background(), 1, 10); err != ErrNoPriority {
+		t.Error("unexpected error", err)
+	}
+	op.CloseInput()
+
+	if mapped, err := op.Wait(context.Background()); err != nil || len(mapped) != 0 {
+		t.Error("unexpected result", mapped, err)
+	}
+}
+
+func TestPriorityInvalid(t *testing.T) {
+	if _, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		return j
+	}, nil, OptPriority(-1)); err != ErrOptInvalidValuePriority {
+		t.Error("unexpected error", err)
+	}
+}
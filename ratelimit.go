@@ -0,0 +1,136 @@
+package parallel
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOptInvalidValueRateLimit indicates the rate limiter is nil or its rate or burst is invalid
+	ErrOptInvalidValueRateLimit = errors.New("invalid option value: rate limit")
+
+	// ErrInvalidRateLimit indicates a rate limiter was set to a rate or burst that is not positive
+	ErrInvalidRateLimit = errors.New("invalid rate limit")
+)
+
+// RateLimiter is a token bucket that throttles the jobs handed from the job queue to the
+// mappers. The bucket holds up to burst tokens and is refilled at rate tokens per second,
+// every job takes a token. A RateLimiter may be shared by operations that call the same
+// service and its rate can be changed while they run
+type RateLimiter struct {
+	// mu guards the fields below, changed is closed and replaced when the rate is set
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	tokens  float64
+	last    time.Time
+	changed chan struct{}
+}
+
+// NewRateLimiter returns a RateLimiter that allows rate jobs per second on average and
+// bursts of up to burst jobs, the bucket starts full
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{rate: rate, burst: burst, tokens: float64(burst), last: time.Now(), changed: make(chan struct{})}
+}
+
+// OptRateLimit throttles the jobs of the operation to rate jobs per second with bursts
+// of up to burst jobs, see OptRateLimiter to share or adjust the limit
+func OptRateLimit(rate float64, burst int) Option {
+	return OptRateLimiter(NewRateLimiter(rate, burst))
+}
+
+// OptRateLimiter throttles the jobs of the operation with r. Jobs wait for a token in the
+// job queue, not in the mapper go routines, so the pool is free to map the jobs of other
+// operations. Batches take a token per job and retries take a token per attempt
+func OptRateLimiter(r *RateLimiter) Option {
+	return func(o *options) error {
+		if r == nil || !validRate(r.rate, r.burst) {
+			return ErrOptInvalidValueRateLimit
+		}
+		o.rateLimiter = r
+		return nil
+	}
+}
+
+func validRate(rate float64, burst int) bool {
+	return rate > 0 && !math.IsInf(rate, 0) && burst > 0
+}
+
+// Rate returns the current rate and burst of the limiter
+func (r *RateLimiter) Rate() (float64, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rate, r.burst
+}
+
+// SetRate changes the rate and burst of the limiter, jobs that are waiting for a token
+// are throttled at the new rate. The tokens already in the bucket are kept up to burst
+func (r *RateLimiter) SetRate(rate float64, burst int) error {
+	if !validRate(rate, burst) {
+		return ErrInvalidRateLimit
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refill(time.Now())
+	r.rate, r.burst = rate, burst
+	r.tokens = math.Min(r.tokens, float64(burst))
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+
+	return nil
+}
+
+// refill adds the tokens accrued since the last refill, mu must be held
+func (r *RateLimiter) refill(now time.Time) {
+	r.tokens = math.Min(float64(r.burst), r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	r.last = now
+}
+
+// wait blocks until n tokens are taken, it returns false without taking any once done
+// is closed. More than burst tokens can be taken at once by leaving the bucket in debt
+func (r *RateLimiter) wait(done <-chan struct{}, n int) bool {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		r.mu.Lock()
+		r.refill(time.Now())
+
+		need := math.Min(float64(n), float64(r.burst))
+		if r.tokens >= need {
+			r.tokens -= float64(n)
+			r.mu.Unlock()
+			return true
+		}
+
+		delay := time.Duration((need - r.tokens) / r.rate * float64(time.Second))
+		changed := r.changed
+		r.mu.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(delay)
+		} else {
+			timer.Reset(delay)
+		}
+
+		select {
+		case <-timer.C:
+		case <-changed:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-done:
+			return false
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package parallel
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// runRated maps n jobs with the rate limiter and returns how long it took
+func runRated(t *testing.T, n int, opts ...Option) time.Duration {
+	t.Helper()
+
+	start := time.Now()
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= n; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	total, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != n*(n+1)/2 {
+		t.Error("total incorrect", total)
+	}
+
+	return time.Since(start)
+}
+
+func TestRateLimit(t *testing.T) {
+	// the burst is mapped at once, the rest at 200 jobs per second
+	if d := runRated(t, 60, OptRateLimit(200, 10), OptQueue(60)); d < 240*time.Millisecond {
+		t.Error("rate exceeded", d)
+	}
+}
+
+func TestRateLimitBatch(t *testing.T) {
+	// a batch larger than the burst leaves the bucket in debt, so each batch
+	// after the first waits for the 20 tokens taken by the previous one
+	if d := runRated(t, 60, OptRateLimit(200, 10), OptBatch(20, 0)); d < 190*time.Millisecond {
+		t.Error("rate exceeded", d)
+	}
+}
+
+func TestRateLimitSet(t *testing.T) {
+	r := NewRateLimiter(1, 1)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := r.SetRate(1000, 10); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// 1 job per second would take 20 seconds
+	if d := runRated(t, 20, OptRateLimiter(r)); d > 5*time.Second {
+		t.Error("rate not changed", d)
+	}
+
+	if rate, burst := r.Rate(); rate != 1000 || burst != 10 {
+		t.Error("unexpected rate", rate, burst)
+	}
+
+	if err := r.SetRate(0, 1); err != ErrInvalidRateLimit {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	op, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+		return j
+	}, nil, OptRateLimit(0.001, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the operation is not held up by the jobs waiting for a token
+	op.Cancel()
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestRateLimitInvalid(t *testing.T) {
+	for _, opt := range []Option{OptRateLimiter(nil), OptRateLimit(0, 1), OptRateLimit(1, 0)} {
+		if _, err := Start(0, func(_ interface{}, j interface{}) interface{} {
+			return j
+		}, nil, opt); err != ErrOptInvalidValueRateLimit {
+			t.Error("unexpected error", err)
+		}
+	}
+}
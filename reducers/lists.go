@@ -28,7 +28,21 @@ func (a *lss) Reducer() func(interface{}, interface{}) interface{} {
 	}
 }
 
-// Then is passed to Parallel to signal the completion of the operations
+// Result converts the output of Op.Wait, no synchronisation is required
+// when the operation was started with parallel.Start
+//
+//	v, err := a.Result(op.Wait(ctx))
+func (a *lss) Result(t interface{}, err error) ([]string, error) {
+	if err != nil {
+		var zero []string
+		return zero, err
+	}
+
+	return t.([]string), nil
+}
+
+// Then is passed to Parallel to signal the completion of the operations,
+// Then and Get are only required when using the `then` callback
 func (a *lss) Then() func(interface{}, error) {
 	return func(t interface{}, err error) {
 		defer a.wg.Done()
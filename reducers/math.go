@@ -1,6 +1,7 @@
 package reducers
 
 import (
+	"reflect"
 	"sync"
 )
 
@@ -58,18 +59,61 @@ func (a *ass) Value() int64 {
 	return a.initial
 }
 
-// Reducer returns fn(p, c) of the input
+// Reducer returns fn(p, c) of the input. Parallel recognises it, see Associative, and
+// folds the outputs of each mapper go routine with it before they reach the reducer. It
+// is then called for every job in the mapper go routines, and in the go routine of the
+// reducer once per fold of a mapper go routine instead of once per job
 func (a *ass) Reducer() func(interface{}, interface{}) interface{} {
-	return func(p interface{}, v interface{}) interface{} {
-		if v == nil {
-			return p
-		}
+	return a.reduce
+}
+
+// Combiner returns fn(a, b) of the outputs of a mapper, it is the reducer as fn is
+// associative. It only needs to be passed to parallel.OptCombiner to set a flush interval
+func (a *ass) Combiner() func(interface{}, interface{}) interface{} {
+	return a.reduce
+}
 
-		return a.fn(p.(int64), v.(int64))
+// reduce is fn(p, v), it accepts both the outputs of the mappers and their local folds
+func (a *ass) reduce(p interface{}, v interface{}) interface{} {
+	if v == nil {
+		return p
 	}
+
+	if p == nil {
+		return v
+	}
+
+	return a.fn(p.(int64), v.(int64))
+}
+
+// associative is the code of the reducers returned by the helpers for associative operations.
+// A func can not carry a marker, and returning a type of parallel instead would make this
+// package import parallel, an import cycle as the tests of parallel use these helpers. The
+// method values of reduce share the same code whatever their receiver, so it identifies
+// them, while a closure or any other func has code of its own
+var associative = reflect.ValueOf((&ass{}).reduce).Pointer()
+
+// Associative reports if reducer was returned by a helper for an associative operation,
+// such as NewAssociativeInt64. The reducer can then also be used as a combiner
+func Associative(reducer func(interface{}, interface{}) interface{}) bool {
+	return reducer != nil && reflect.ValueOf(reducer).Pointer() == associative
+}
+
+// Result converts the output of Op.Wait, no synchronisation is required
+// when the operation was started with parallel.Start
+//
+//	v, err := a.Result(op.Wait(ctx))
+func (a *ass) Result(t interface{}, err error) (int64, error) {
+	if err != nil {
+		var zero int64
+		return zero, err
+	}
+
+	return t.(int64), nil
 }
 
-// Then is passed to Parallel to signal the completion of the operations
+// Then is passed to Parallel to signal the completion of the operations,
+// Then and Get are only required when using the `then` callback
 func (a *ass) Then() func(interface{}, error) {
 	return func(t interface{}, err error) {
 		defer a.wg.Done()
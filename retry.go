@@ -0,0 +1,95 @@
+package parallel
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ErrOptInvalidValueRetry indicates the retry policy is invalid or was used with both
+// OptOrdered and OptBatch
+var ErrOptInvalidValueRetry = errors.New("invalid option value: retry")
+
+// RetryPolicy controls how jobs that a mapper failed on are retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a job is mapped before it fails, including the first
+	MaxAttempts int
+	// BaseBackoff is the delay before the second attempt, it doubles for every further
+	// attempt up to MaxBackoff if it is not 0
+	BaseBackoff, MaxBackoff time.Duration
+	// Jitter shortens every delay by a random fraction up to Jitter, between 0 and 1
+	Jitter float64
+	// Retryable reports if a job that failed with err should be retried, by default every
+	// error other than an ErrTrappedPanic is retried
+	Retryable func(err error) bool
+	// Done is called for every job once it has been mapped or has failed with the number
+	// of attempts it took, it is optional
+	Done func(job interface{}, attempts int, err error)
+}
+
+// ErrAttempts wraps the error of a job that failed under OptRetry with the number of
+// attempts it took
+type ErrAttempts struct {
+	Err      error
+	Attempts int
+}
+
+func (e ErrAttempts) Error() string {
+	return fmt.Sprintf("%v (after %d attempts)", e.Err, e.Attempts)
+}
+
+// Unwrap returns the error of the last attempt
+func (e ErrAttempts) Unwrap() error {
+	return e.Err
+}
+
+// OptRetry retries the jobs that a mapper fails on, or panics on, according to policy. A
+// job is re-queued once its backoff expires so the mapper go routine moves on to the next
+// job in the meantime. Once the attempts are exhausted, or the error is not retryable,
+// the job fails according to OptFailure wrapped in an ErrAttempts or is passed to
+// OptDeadLetter. With OptOrdered the outputs stay in submission order but OptBatch can
+// not be used
+func OptRetry(policy RetryPolicy) Option {
+	return func(o *options) error {
+		if policy.MaxAttempts < 1 || policy.BaseBackoff < 0 || policy.MaxBackoff < 0 ||
+			policy.Jitter < 0 || policy.Jitter > 1 {
+			return ErrOptInvalidValueRetry
+		}
+		o.retry = &policy
+		return nil
+	}
+}
+
+// retryable reports if a job that failed with err on its attempt should be retried
+func (p *RetryPolicy) retryable(attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	var pnk ErrTrappedPanic
+	return !errors.As(err, &pnk)
+}
+
+// backoff returns the delay after the attempt before the next one
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseBackoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || d < p.MaxBackoff) && d < math.MaxInt64/2; i++ {
+		d *= 2
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+
+	return d
+}
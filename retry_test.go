@@ -0,0 +1,231 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flaky fails every job until it has been attempted n times
+type flaky struct {
+	mu       sync.Mutex
+	n        int
+	attempts map[int]int
+}
+
+func newFlaky(n int) *flaky {
+	return &flaky{n: n, attempts: make(map[int]int)}
+}
+
+func (f *flaky) mapper(_ interface{}, j int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts[j]++
+	if f.attempts[j] < f.n {
+		return 0, errOdd
+	}
+
+	return j, nil
+}
+
+func sum(p int, c int) int {
+	return p + c
+}
+
+func runRetry(t *testing.T, mapper func(interface{}, int) (int, error), n int, opts ...Option) (int, error) {
+	t.Helper()
+
+	op, err := StartErrOf(0, mapper, sum, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= n; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			break
+		}
+	}
+	op.CloseInput()
+
+	return op.Wait(context.Background())
+}
+
+func TestRetry(t *testing.T) {
+	f := newFlaky(3)
+
+	var mu sync.Mutex
+	attempts := make(map[interface{}]int)
+
+	total, err := runRetry(t, f.mapper, 100, OptRetry(RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		Jitter:      0.5,
+		Done: func(job interface{}, n int, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				t.Error("unexpected error", job, err)
+			}
+			attempts[job] = n
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 5050 {
+		t.Error("total incorrect", total)
+	}
+
+	if len(attempts) != 100 || attempts[1] != 3 || attempts[100] != 3 {
+		t.Error("unexpected attempts", attempts)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	_, err := runRetry(t, newFlaky(4).mapper, 10, OptRetry(RetryPolicy{MaxAttempts: 3}))
+
+	var ae ErrAttempts
+	if !errors.As(err, &ae) || ae.Attempts != 3 || !errors.Is(err, errOdd) {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestRetryOrdered(t *testing.T) {
+	f := newFlaky(2)
+
+	op, err := StartErrOf([]int(nil), func(s interface{}, j int) (int, error) {
+		// only every third job is flaky
+		if j%3 == 0 {
+			return f.mapper(s, j)
+		}
+		return j, nil
+	}, func(p []int, c int) []int {
+		return append(p, c)
+	}, OptOrdered(), OptReorderWindow(2), OptRetry(RetryPolicy{MaxAttempts: 2, BaseBackoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	all, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range all {
+		if i != v {
+			t.Fatal("out of order", all)
+		}
+	}
+
+	if len(all) != 100 {
+		t.Error("missing outputs", len(all))
+	}
+}
+
+func TestRetryBatch(t *testing.T) {
+	total, err := runRetry(t, newFlaky(2).mapper, 100, OptBatch(8, 0), OptRetry(RetryPolicy{MaxAttempts: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 5050 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestRetryPanic(t *testing.T) {
+	var once sync.Map
+	panicOnce := func(_ interface{}, j int) (int, error) {
+		if _, seen := once.LoadOrStore(j, true); !seen {
+			panic("junk")
+		}
+		return j, nil
+	}
+
+	// panics are not retried by default
+	_, err := runRetry(t, panicOnce, 10, OptRetry(RetryPolicy{MaxAttempts: 2}))
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) || pnk.Panic != "junk" {
+		t.Error("unexpected error", err)
+	}
+
+	once = sync.Map{}
+	total, err := runRetry(t, panicOnce, 10, OptRetry(RetryPolicy{MaxAttempts: 2, Retryable: func(error) bool {
+		return true
+	}}))
+	if err != nil || total != 55 {
+		t.Error("unexpected result", total, err)
+	}
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	var letters []DeadLetter
+
+	total, err := runRetry(t, func(_ interface{}, j int) (int, error) {
+		if j%2 == 1 {
+			return 0, errOdd
+		}
+		return j, nil
+	}, 10, OptRetry(RetryPolicy{MaxAttempts: 3}), OptDeadLetter(func(d DeadLetter) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		letters = append(letters, d)
+	}))
+	if err != nil || total != 30 {
+		t.Error("unexpected result", total, err)
+	}
+
+	if len(letters) != 5 {
+		t.Fatal("unexpected letters", letters)
+	}
+
+	for _, d := range letters {
+		if d.Attempts != 3 || d.Err != errOdd {
+			t.Error("unexpected letter", d)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	for attempt, d := range []time.Duration{0, 1, 2, 4, 5, 5} {
+		if attempt > 0 && p.backoff(attempt) != d*time.Millisecond {
+			t.Error("unexpected backoff", attempt, p.backoff(attempt))
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(3); d < 2*time.Millisecond || d > 4*time.Millisecond {
+			t.Error("unexpected backoff", d)
+		}
+	}
+}
+
+func TestRetryInvalid(t *testing.T) {
+	for _, opts := range [][]Option{
+		{OptRetry(RetryPolicy{})},
+		{OptRetry(RetryPolicy{MaxAttempts: 1, Jitter: 2})},
+		{OptRetry(RetryPolicy{MaxAttempts: 1}), OptOrdered(), OptBatch(2, 0)},
+	} {
+		if _, err := StartErrOf(0, newFlaky(1).mapper, sum, opts...); err != ErrOptInvalidValueRetry {
+			t.Error("unexpected error", err)
+		}
+	}
+}
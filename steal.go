@@ -0,0 +1,288 @@
+package parallel
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// OptWorkStealing gives each mapper go routine of the operation its own queue of jobs in
+// place of the job queue they share, a go routine that runs out of jobs steals them from
+// the others. Submit writes straight into the queues so the go routines of an Op no longer
+// contend on a channel, with Parallel or the options that feed the jobs to the mappers, such
+// as OptOrdered or OptBatch, the jobs are read from the job queue by a single go routine.
+// OptQueue is the total size of the queues. Jobs may be mapped in a different order,
+// OptOrdered still reduces them in order
+func OptWorkStealing() Option {
+	return func(o *options) error {
+		o.stealing = true
+		return nil
+	}
+}
+
+// deque is a bounded queue of tasks, the owner takes from the front and thieves from the back.
+// n is read without the lock so empty deques are skipped cheaply. It is padded so the go
+// routines working on neighbouring deques do not share a cache line
+type deque[J any] struct {
+	mu    sync.Mutex
+	tasks []task[J]
+	head  int
+	n     int32
+	_     [64]byte
+}
+
+func (d *deque[J]) push(t task[J]) bool {
+	if int(atomic.LoadInt32(&d.n)) == len(d.tasks) {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := int(d.n)
+	if n == len(d.tasks) {
+		return false
+	}
+
+	d.tasks[(d.head+n)%len(d.tasks)] = t
+	atomic.StoreInt32(&d.n, int32(n+1))
+
+	return true
+}
+
+func (d *deque[J]) pop() (task[J], bool) {
+	var t task[J]
+	if atomic.LoadInt32(&d.n) == 0 {
+		return t, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.n == 0 {
+		return t, false
+	}
+
+	t, d.tasks[d.head] = d.tasks[d.head], t
+	d.head = (d.head + 1) % len(d.tasks)
+	atomic.StoreInt32(&d.n, d.n-1)
+
+	return t, true
+}
+
+func (d *deque[J]) steal() (task[J], bool) {
+	var t task[J]
+	if atomic.LoadInt32(&d.n) == 0 {
+		return t, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.n == 0 {
+		return t, false
+	}
+
+	i := (d.head + int(d.n) - 1) % len(d.tasks)
+	t, d.tasks[i] = d.tasks[i], t
+	atomic.StoreInt32(&d.n, d.n-1)
+
+	return t, true
+}
+
+// stealer replaces the job queue of an operation with a deque per go routine, go routines
+// whose index is beyond the deques share them. Tasks are pushed by Submit or the feeder and
+// nothing is signalled unless a go routine is waiting for a task or for space
+type stealer[J any] struct {
+	deques []deque[J]
+	// next is the deque the next push tries first
+	next uint32
+
+	// idle counts the go routines waiting on wake, which is signalled when a task is
+	// pushed and closed once there are no more tasks
+	idle   int32
+	wake   chan struct{}
+	closed int32
+
+	// waiting counts the pushes waiting on space, which is closed and replaced under mu
+	// when a task is taken
+	waiting int32
+	mu      sync.Mutex
+	space   chan struct{}
+}
+
+// newStealer returns a stealer with n deques that hold size tasks between them
+func newStealer[J any](n, size int) *stealer[J] {
+	s := &stealer[J]{
+		deques: make([]deque[J], n),
+		wake:   make(chan struct{}, n),
+		space:  make(chan struct{}),
+	}
+
+	per := (size + n - 1) / n
+	if per < 1 {
+		per = 1
+	}
+	for i := range s.deques {
+		s.deques[i].tasks = make([]task[J], per)
+	}
+
+	return s
+}
+
+// offer pushes t on the first deque with space, starting after the last one used
+func (s *stealer[J]) offer(t task[J]) bool {
+	start := int(atomic.AddUint32(&s.next, 1) % uint32(len(s.deques)))
+
+	for k := range s.deques {
+		if s.deques[(start+k)%len(s.deques)].push(t) {
+			if atomic.LoadInt32(&s.idle) > 0 {
+				select {
+				case s.wake <- struct{}{}:
+				default:
+				}
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// send blocks until t is queued, it returns false if done is closed first
+func (s *stealer[J]) send(t task[J], done <-chan struct{}) bool {
+	for !s.offer(t) {
+		space := s.reserve()
+		if s.offer(t) {
+			s.release()
+			return true
+		}
+
+		select {
+		case <-space:
+		case <-done:
+			s.release()
+			return false
+		}
+		s.release()
+	}
+
+	return true
+}
+
+// reserve counts the caller as waiting for space until it calls release, the channel
+// returned is closed once a task is taken. The caller must try to push again before it
+// waits on the channel as a task may have been taken in between
+func (s *stealer[J]) reserve() <-chan struct{} {
+	atomic.AddInt32(&s.waiting, 1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.space
+}
+
+func (s *stealer[J]) release() {
+	atomic.AddInt32(&s.waiting, -1)
+}
+
+// dropOldest discards the task at the front of a deque, starting with the one the next
+// push tries first
+func (s *stealer[J]) dropOldest() bool {
+	start := int(atomic.LoadUint32(&s.next) % uint32(len(s.deques)))
+
+	for k := range s.deques {
+		if _, ok := s.deques[(start+k)%len(s.deques)].pop(); ok {
+			s.freed()
+			return true
+		}
+	}
+
+	return false
+}
+
+// freed wakes the pushes waiting for space
+func (s *stealer[J]) freed() {
+	if atomic.LoadInt32(&s.waiting) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.space)
+	s.space = make(chan struct{})
+}
+
+// close signals that no more tasks will be pushed
+func (s *stealer[J]) close() {
+	atomic.StoreInt32(&s.closed, 1)
+	close(s.wake)
+}
+
+// take returns the next task for the go routine with index i, taken from its own deque or
+// stolen from another. If there is none closed reports whether more tasks may be pushed, if
+// they may the go routine is counted as idle and must wait on wake, then call awake
+func (s *stealer[J]) take(i int) (t task[J], ok bool, closed bool) {
+	for idle := false; ; idle = true {
+		closed = atomic.LoadInt32(&s.closed) == 1
+
+		own := i % len(s.deques)
+		t, ok = s.deques[own].pop()
+		for k := 1; !ok && k < len(s.deques); k++ {
+			t, ok = s.deques[(own+k)%len(s.deques)].steal()
+		}
+
+		if ok || closed {
+			if idle {
+				s.awake()
+			}
+			if ok {
+				s.freed()
+			}
+			return t, ok, closed
+		}
+
+		// look again once counted as idle, so a task pushed in between signals wake
+		if idle {
+			return t, false, false
+		}
+		atomic.AddInt32(&s.idle, 1)
+	}
+}
+
+// awake stops counting a go routine that waited on wake as idle
+func (s *stealer[J]) awake() {
+	atomic.AddInt32(&s.idle, -1)
+}
+
+// push blocks until job is queued in the deques of the mappers, see Submit
+func (q *input[J]) push(ctx context.Context, job J) error {
+	t := task[J]{job: job}
+
+	for !q.steal.offer(t) {
+		space := q.steal.reserve()
+		if q.steal.offer(t) {
+			q.steal.release()
+			return nil
+		}
+
+		var err error
+		select {
+		case <-space:
+		case <-q.closing:
+			err = ErrOpClosed
+		case <-q.ctx.Done():
+			err = q.cancelled()
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		q.steal.release()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// sumJobs maps the jobs 1 to n and returns their sum
+func sumJobs(t testing.TB, n int, opts ...Option) (int, error) {
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= n; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			break
+		}
+	}
+	op.CloseInput()
+
+	return op.Wait(context.Background())
+}
+
+func TestWorkStealing(t *testing.T) {
+	for _, opts := range [][]Option{
+		{OptWorkStealing()},
+		{OptWorkStealing(), OptOrdered()},
+		{OptWorkStealing(), OptBatch(7, 0)},
+		{OptWorkStealing(), OptCombinerOf(func(a, b int) int { return a + b }, 0)},
+	} {
+		total, err := sumJobs(t, 10000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if total != 50005000 {
+			t.Error("total incorrect", total)
+		}
+	}
+}
+
+func TestWorkStealingUneven(t *testing.T) {
+	m, c := OptMappers(4, nil, nil)
+	defer c()
+
+	// jobs are spread evenly so the go routine blocked on the first job relies on the
+	// others to steal the jobs queued for it
+	block := make(chan struct{})
+	var once sync.Once
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		if j == 1 {
+			<-block
+		}
+		return j
+	}, func(p int, c int) int {
+		if c == 100 {
+			once.Do(func() { close(block) })
+		}
+		return p + c
+	}, m, OptWorkStealing())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 100; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	if total, err := op.Wait(context.Background()); err != nil || total != 5050 {
+		t.Error("unexpected result", total, err)
+	}
+}
+
+func TestWorkStealingPanic(t *testing.T) {
+	op, err := StartOf(0, func(_ interface{}, j int) int {
+		if j == 500 {
+			panic("junk")
+		}
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, OptWorkStealing())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 1000; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			break
+		}
+	}
+	op.CloseInput()
+
+	_, err = op.Wait(context.Background())
+
+	var pnk ErrTrappedPanic
+	if !errors.As(err, &pnk) || pnk.Panic != "junk" {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestWorkStealingResize(t *testing.T) {
+	p := NewPool(2, nil, nil)
+	defer p.Cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for _, sz := range []int{8, 1, 4, 2} {
+			if err := p.Resize(sz); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	total, err := sumJobs(t, 10000, p.Option(), OptWorkStealing())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 50005000 {
+		t.Error("total incorrect", total)
+	}
+	<-done
+}
+
+func TestWorkStealingParallel(t *testing.T) {
+	var total int
+	done := make(chan struct{})
+
+	q, err := ParallelOf(0, func(_ interface{}, j int) int {
+		return j
+	}, func(p int, c int) int {
+		return p + c
+	}, func(final int, err error) {
+		total = final
+		close(done)
+	}, OptWorkStealing())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 10000; i++ {
+		q <- i
+	}
+	close(q)
+	<-done
+
+	if total != 50005000 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestWorkStealingFed(t *testing.T) {
+	for _, opts := range [][]Option{
+		{OptWorkStealing(), OptRetry(RetryPolicy{MaxAttempts: 2})},
+		{OptWorkStealing(), OptRateLimit(1e6, 1000)},
+		{OptWorkStealing(), OptPriority(0)},
+	} {
+		total, err := sumJobs(t, 1000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if total != 500500 {
+			t.Error("total incorrect", total)
+		}
+	}
+}
+
+func TestWorkStealingOverflow(t *testing.T) {
+	// Submit blocks while the deques are full
+	gate := make(chan struct{})
+	op := startGated(t, gate, 2, OptWorkStealing())
+
+	n := fill(t, op)
+
+	submitted := make(chan error)
+	go func() {
+		submitted <- op.Submit(context.Background(), n)
+	}()
+
+	eventually(t, func() bool { return op.Overflows().Blocked == 1 })
+	close(gate)
+
+	if err := <-submitted; err != nil {
+		t.Fatal(err)
+	}
+	op.CloseInput()
+
+	if mapped, err := op.Wait(context.Background()); err != nil || len(mapped) != n+1 {
+		t.Error("unexpected result", len(mapped), err)
+	}
+
+	// the oldest jobs are dropped
+	gate = make(chan struct{})
+	op = startGated(t, gate, 2, OptWorkStealing(), OptOverflow(OverflowDropOldest))
+
+	for i := 0; i < 100; i++ {
+		if err := op.TrySubmit(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(gate)
+	op.CloseInput()
+
+	mapped, err := op.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st := op.Overflows(); st.Dropped == 0 || int64(len(mapped))+st.Dropped != 100 || mapped[len(mapped)-1] != 99 {
+		t.Error("unexpected stats", st, mapped)
+	}
+}
+
+func TestWorkStealingCancel(t *testing.T) {
+	gate := make(chan struct{})
+
+	op := startGated(t, gate, 2, OptWorkStealing())
+	n := fill(t, op)
+
+	submitted := make(chan error)
+	go func() {
+		submitted <- op.Submit(context.Background(), n)
+	}()
+
+	eventually(t, func() bool { return op.Overflows().Blocked == 1 })
+	op.Cancel()
+
+	if err := <-submitted; !errors.Is(err, ErrOpCancelled) {
+		t.Error("unexpected error", err)
+	}
+	close(gate)
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
+
+// benchmarkTiny maps 1000 jobs that do no work per iteration on 4 go routines, so they
+// contend for the jobs when run with -cpu 4 or more
+func benchmarkTiny(b *testing.B, opts ...Option) {
+	m, c := OptMappers(4, nil, nil)
+	defer c()
+
+	opts = append(opts, m, OptQueue(1000))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		total, err := sumJobs(b, 1000, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if total != 500500 {
+			b.Error("total incorrect", total)
+		}
+	}
+}
+
+func BenchmarkTinyShared(b *testing.B) {
+	benchmarkTiny(b)
+}
+
+func BenchmarkTinyStealing(b *testing.B) {
+	benchmarkTiny(b, OptWorkStealing())
+}
+
+func BenchmarkTinySharedCombiner(b *testing.B) {
+	benchmarkTiny(b, OptCombinerOf(func(a, b int) int { return a + b }, 0))
+}
+
+func BenchmarkTinyStealingCombiner(b *testing.B) {
+	benchmarkTiny(b, OptWorkStealing(), OptCombinerOf(func(a, b int) int { return a + b }, 0))
+}
+
+// BenchmarkMappersStealing is BenchmarkMappers with OptWorkStealing, the jobs written to
+// the channel of Parallel are handed to the deques by a single go routine
+func BenchmarkMappersStealing(b *testing.B) {
+	var and sync.WaitGroup
+
+	m, c := OptMappers(0, nil, nil)
+	defer c()
+
+	for n := 0; n < b.N; n++ {
+		and.Add(1)
+
+		var total int
+
+		q, err := Parallel(0,
+			func(_ interface{}, j interface{}) interface{} {
+				return j
+			}, func(p interface{}, a interface{}) interface{} {
+				return p.(int) + a.(int)
+			}, func(t interface{}, err error) {
+				total = t.(int)
+				and.Done()
+			}, m, OptWorkStealing())
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, v := range []int{0, 1, 2, -1} {
+			q <- v
+		}
+		close(q)
+
+		and.Wait()
+
+		if total != 2 {
+			b.Error("total incorrect", total, b.N)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobTimeout(t *testing.T) {
+	op, err := StartCtxOf(0, func(ctx context.Context, _ interface{}, j int) (int, error) {
+		if j == 3 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return j, nil
+	}, func(p int, c int) int {
+		return p + c
+	}, OptJobTimeout(10*time.Millisecond), OptFailure(CollectAll))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op.CloseInput()
+
+	total, err := op.Wait(context.Background())
+	if !errors.Is(err, ErrJobTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("unexpected error", err)
+	}
+
+	if total != 42 {
+		t.Error("total incorrect", total)
+	}
+}
+
+func TestJobTimeoutStuck(t *testing.T) {
+	p := NewPool(2, nil, nil)
+	defer p.Cancel()
+
+	release := make(chan struct{})
+	op, err := StartCtx(0, func(_ context.Context, _ interface{}, j interface{}) (interface{}, error) {
+		// ignores the context
+		<-release
+		return j, nil
+	}, nil, OptJobTimeout(5*time.Millisecond), p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := op.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return len(p.Stuck()) == 1 })
+
+	close(release)
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); !errors.Is(err, ErrJobTimeout) {
+		t.Error("unexpected error", err)
+	}
+
+	if s := p.Stuck(); len(s) != 0 {
+		t.Error("unexpected stuck", s)
+	}
+}
+
+func TestJobTimeoutStuckResize(t *testing.T) {
+	p := NewPool(2, nil, nil)
+	defer p.Cancel()
+
+	release := make(chan struct{})
+	op, err := StartCtx(0, func(_ context.Context, _ interface{}, j interface{}) (interface{}, error) {
+		// ignores the context
+		<-release
+		return j, nil
+	}, nil, OptJobTimeout(5*time.Millisecond), p.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := op.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eventually(t, func() bool { return len(p.Stuck()) == 2 })
+
+	// the stopped go routine is still stuck on its job
+	if err := p.Resize(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := p.Stuck(); len(s) != 2 || s[0] != 0 || s[1] != 1 {
+		t.Error("unexpected stuck", s)
+	}
+
+	close(release)
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); !errors.Is(err, ErrJobTimeout) {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestJobTimeoutCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	op, err := StartCtx(0, func(ctx context.Context, _ interface{}, j interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, nil, OptContext(ctx), OptJobTimeout(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := op.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	op.CloseInput()
+
+	// cancelling the operation is not reported as a timeout
+	if _, err := op.Wait(context.Background()); err != context.Canceled {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestJobTimeoutRetry(t *testing.T) {
+	var letters []DeadLetter
+	op, err := StartCtxOf(0, func(ctx context.Context, _ interface{}, j int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}, func(p int, c int) int {
+		return p + c
+	}, OptJobTimeout(time.Millisecond), OptRetry(RetryPolicy{MaxAttempts: 3}), OptDeadLetter(func(d DeadLetter) {
+		letters = append(letters, d)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := op.Submit(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	op.CloseInput()
+
+	if _, err := op.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(letters) != 1 || letters[0].Attempts != 3 || !errors.Is(letters[0].Err, ErrJobTimeout) {
+		t.Error("unexpected dead letters", letters)
+	}
+}
+
+func TestJobTimeoutInvalid(t *testing.T) {
+	if _, err := StartCtx(0, func(_ context.Context, _ interface{}, j interface{}) (interface{}, error) {
+		return j, nil
+	}, nil, OptJobTimeout(0)); err != ErrOptInvalidValueJobTimeout {
+		t.Error("unexpected error", err)
+	}
+}